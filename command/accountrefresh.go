@@ -0,0 +1,146 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/riotgames/key-conjurer/internal/apiclient"
+)
+
+// DefaultAccountsMaxAge is how old, in hours, the account cache may be before get refreshes it automatically.
+const DefaultAccountsMaxAge uint = 24
+
+// accountsRefreshRetryInterval is how long get waits before trying an automatic account refresh again after one failed.
+const accountsRefreshRetryInterval = time.Hour
+
+// accountRefreshWaitTimeout bounds how long get waits for an automatic account refresh to finish after credentials have been written.
+const accountRefreshWaitTimeout = 2 * time.Second
+
+// accountRename records an account whose name changed on the account server.
+type accountRename struct {
+	ID, From, To string
+}
+
+// accountDiff describes how the account cache changed after a refresh.
+type accountDiff struct {
+	Added   []Account
+	Removed []Account
+	Renamed []accountRename
+}
+
+func (d *accountDiff) sort() {
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].ID < d.Added[j].ID })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].ID < d.Removed[j].ID })
+	sort.Slice(d.Renamed, func(i, j int) bool { return d.Renamed[i].ID < d.Renamed[j].ID })
+}
+
+func (d accountDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Renamed) == 0
+}
+
+// Write prints one line per change, prefixed with + for added accounts, - for removed accounts and ~ for renamed accounts.
+func (d accountDiff) Write(w io.Writer) {
+	for _, acc := range d.Added {
+		fmt.Fprintf(w, "+ %s (%s)\n", acc.Name, acc.ID)
+	}
+	for _, acc := range d.Removed {
+		fmt.Fprintf(w, "- %s (%s)\n", acc.Name, acc.ID)
+	}
+	for _, r := range d.Renamed {
+		fmt.Fprintf(w, "~ %s renamed to %s (%s)\n", r.From, r.To, r.ID)
+	}
+}
+
+// AccountsAge returns how long ago the account cache was refreshed, or false if it never has been.
+func (c *Config) AccountsAge(now time.Time) (time.Duration, bool) {
+	if c.AccountsRefreshedAt == nil {
+		return 0, false
+	}
+	return now.Sub(*c.AccountsRefreshedAt), true
+}
+
+// AccountsStale indicates whether the account cache is older than maxAge hours, or has never been refreshed.
+func (c *Config) AccountsStale(now time.Time, maxAge uint) bool {
+	age, ok := c.AccountsAge(now)
+	return !ok || age > time.Duration(maxAge)*time.Hour
+}
+
+// AccountsRefreshDue indicates whether get should refresh the account cache automatically.
+// This is the case when the cache is stale and get has not tried to refresh it within accountsRefreshRetryInterval.
+func (c *Config) AccountsRefreshDue(now time.Time, maxAge uint) bool {
+	if !c.AccountsStale(now, maxAge) {
+		return false
+	}
+	return c.AccountsRefreshAttemptedAt == nil || now.Sub(*c.AccountsRefreshAttemptedAt) > accountsRefreshRetryInterval
+}
+
+// describeAccountsAge returns a phrase such as "last refreshed 3 hours ago" for use in warnings.
+func (c *Config) describeAccountsAge(now time.Time) string {
+	age, ok := c.AccountsAge(now)
+	if !ok {
+		return "never refreshed"
+	}
+	return "last refreshed " + formatAge(age)
+}
+
+func formatAge(age time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return plural(int(age/time.Minute), "minute")
+	case age < 48*time.Hour:
+		return plural(int(age/time.Hour), "hour")
+	default:
+		return plural(int(age/(24*time.Hour)), "day")
+	}
+}
+
+// isUnavailableError indicates whether err was caused by being unable to reach the account server or the server failing, as opposed to the server rejecting the request.
+func isUnavailableError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var statusErr *apiclient.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 500 {
+		return true
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+type accountRefreshResult struct {
+	Accounts []Account
+	Err      error
+}
+
+// startAccountRefresh refreshes the account list in a separate goroutine. The result is delivered on the returned channel, which has capacity for it so the goroutine never blocks.
+func startAccountRefresh(ctx context.Context, serverAddr *url.URL, rules *AliasRules) <-chan accountRefreshResult {
+	ch := make(chan accountRefreshResult, 1)
+	go func() {
+		accounts, err := refreshAccounts(ctx, serverAddr, &keychainTokenSource{}, rules)
+		ch <- accountRefreshResult{Accounts: accounts, Err: err}
+	}()
+	return ch
+}
@@ -0,0 +1,192 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/riotgames/key-conjurer/internal/api"
+	"github.com/riotgames/key-conjurer/internal/apiclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestUpdateAccountsReportsChanges(t *testing.T) {
+	cfg := Config{}
+	cfg.AddAccount("1", Account{ID: "1", Name: "AWS - one"})
+	cfg.AddAccount("2", Account{ID: "2", Name: "AWS - two"})
+
+	diff := cfg.UpdateAccounts([]Account{
+		{ID: "1", Name: "AWS - uno"},
+		{ID: "3", Name: "AWS - three"},
+	})
+
+	require.Len(t, diff.Added, 1)
+	assert.Equal(t, "3", diff.Added[0].ID)
+	require.Len(t, diff.Removed, 1)
+	assert.Equal(t, "2", diff.Removed[0].ID)
+	assert.Equal(t, []accountRename{{ID: "1", From: "AWS - one", To: "AWS - uno"}}, diff.Renamed)
+	require.NotNil(t, cfg.AccountsRefreshedAt)
+
+	var buf bytes.Buffer
+	diff.Write(&buf)
+	assert.Equal(t, "+ AWS - three (3)\n- AWS - two (2)\n~ AWS - one renamed to AWS - uno (1)\n", buf.String())
+
+	assert.True(t, cfg.UpdateAccounts([]Account{{ID: "1", Name: "AWS - uno"}, {ID: "3", Name: "AWS - three"}}).Empty())
+}
+
+func TestAccountsStale(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	cfg := Config{}
+	assert.True(t, cfg.AccountsStale(now, 24), "a cache which has never been refreshed is stale")
+	assert.Equal(t, "never refreshed", cfg.describeAccountsAge(now))
+
+	refreshed := now.Add(-3 * time.Hour)
+	cfg.AccountsRefreshedAt = &refreshed
+	assert.False(t, cfg.AccountsStale(now, 24))
+	assert.True(t, cfg.AccountsStale(now, 2))
+	assert.Equal(t, "last refreshed 3 hours ago", cfg.describeAccountsAge(now))
+}
+
+func TestAccountsRefreshDue(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	refreshed := now.Add(-48 * time.Hour)
+	cfg := Config{AccountsRefreshedAt: &refreshed}
+	assert.True(t, cfg.AccountsRefreshDue(now, 24))
+
+	attempted := now.Add(-10 * time.Minute)
+	cfg.AccountsRefreshAttemptedAt = &attempted
+	assert.False(t, cfg.AccountsRefreshDue(now, 24), "a refresh which failed recently should not be retried")
+
+	attempted = now.Add(-accountsRefreshRetryInterval - time.Minute)
+	assert.True(t, cfg.AccountsRefreshDue(now, 24))
+	assert.False(t, cfg.AccountsRefreshDue(now, 72), "a cache which is not stale does not need refreshing")
+}
+
+func TestFinishAccountRefresh(t *testing.T) {
+	g := GetCommand{MachineOutput: true}
+	finished := func(result accountRefreshResult) <-chan accountRefreshResult {
+		ch := make(chan accountRefreshResult, 1)
+		ch <- result
+		return ch
+	}
+
+	t.Run("Completed", func(t *testing.T) {
+		var stderr bytes.Buffer
+		g := GetCommand{Stderr: &stderr, PrintErrln: func(a ...any) { fmt.Fprintln(&stderr, a...) }}
+		refreshed := time.Now().Add(-48 * time.Hour)
+		cfg := Config{AccountsRefreshedAt: &refreshed}
+		cfg.AddAccount("1", Account{ID: "1", Name: "AWS - one"})
+
+		g.finishAccountRefresh(&cfg, finished(accountRefreshResult{Accounts: []Account{{ID: "1", Name: "AWS - one"}, {ID: "2", Name: "AWS - two"}}}), time.Second)
+		assert.True(t, cfg.AccountsRefreshedAt.After(refreshed))
+		assert.Nil(t, cfg.AccountsRefreshAttemptedAt)
+		assert.Equal(t, "Changes since the last refresh:\n+ AWS - two (2)\n", stderr.String())
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		cfg := Config{}
+		g.finishAccountRefresh(&cfg, finished(accountRefreshResult{Err: &apiclient.StatusError{StatusCode: http.StatusBadGateway}}), time.Second)
+		assert.Nil(t, cfg.AccountsRefreshedAt)
+		assert.NotNil(t, cfg.AccountsRefreshAttemptedAt)
+	})
+
+	t.Run("NotLoggedIn", func(t *testing.T) {
+		cfg := Config{}
+		g.finishAccountRefresh(&cfg, finished(accountRefreshResult{Err: ErrTokensExpiredOrAbsent}), time.Second)
+		assert.Nil(t, cfg.AccountsRefreshAttemptedAt)
+	})
+
+	t.Run("WaitsForRefresh", func(t *testing.T) {
+		cfg := Config{}
+		cfg.AddAccount("1", Account{ID: "1", Name: "AWS - one"})
+		ch := make(chan accountRefreshResult, 1)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			ch <- accountRefreshResult{Accounts: []Account{{ID: "1", Name: "AWS - one"}}}
+		}()
+
+		g.finishAccountRefresh(&cfg, ch, 5*time.Second)
+		assert.NotNil(t, cfg.AccountsRefreshedAt, "a refresh which completes shortly after credentials are written should still be used")
+	})
+
+	t.Run("Abandoned", func(t *testing.T) {
+		cfg := Config{}
+		g.finishAccountRefresh(&cfg, make(chan accountRefreshResult), 10*time.Millisecond)
+		assert.Nil(t, cfg.AccountsRefreshedAt)
+		assert.Nil(t, cfg.AccountsRefreshAttemptedAt, "a refresh which was abandoned did not fail, so it should be retried")
+	})
+}
+
+func TestFormatAge(t *testing.T) {
+	assert.Equal(t, "just now", formatAge(10*time.Second))
+	assert.Equal(t, "1 minute ago", formatAge(time.Minute))
+	assert.Equal(t, "45 minutes ago", formatAge(45*time.Minute))
+	assert.Equal(t, "1 hour ago", formatAge(time.Hour+10*time.Minute))
+	assert.Equal(t, "47 hours ago", formatAge(47*time.Hour))
+	assert.Equal(t, "3 days ago", formatAge(72*time.Hour))
+}
+
+func TestIsUnavailableError(t *testing.T) {
+	assert.True(t, isUnavailableError(fmt.Errorf("wrapped: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")})))
+	assert.True(t, isUnavailableError(&url.Error{Op: "Post", URL: "https://example.com", Err: &net.DNSError{Err: "no such host"}}))
+	assert.True(t, isUnavailableError(context.DeadlineExceeded))
+	assert.True(t, isUnavailableError(&apiclient.StatusError{StatusCode: http.StatusBadGateway}))
+	assert.False(t, isUnavailableError(&apiclient.StatusError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, isUnavailableError(apiclient.ErrForbidden))
+	assert.False(t, isUnavailableError(ErrTokensExpiredOrAbsent))
+}
+
+func TestRefreshAccountsReturnsNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]api.Application{{ID: "1", Name: "AWS - one"}})
+	}))
+	serverAddr, _ := url.Parse(srv.URL)
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+
+	accounts, err := refreshAccounts(context.Background(), serverAddr, ts, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Account{{ID: "1", Name: "AWS - one", Aliases: []string{"one"}}}, accounts)
+
+	srv.Close()
+	_, err = refreshAccounts(context.Background(), serverAddr, ts, nil)
+	assert.True(t, isUnavailableError(err), "expected a network error, got %v", err)
+}
+
+func TestRefreshAccountsRequiresLoginWhenUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	serverAddr, _ := url.Parse(srv.URL)
+
+	_, err := refreshAccounts(context.Background(), serverAddr, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}), nil)
+	assert.ErrorIs(t, err, ErrTokensExpiredOrAbsent)
+}
+
+func TestServerCompatibilityWarning(t *testing.T) {
+	var info api.VersionInfo
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(info)
+	}))
+	defer srv.Close()
+	serverAddr, _ := url.Parse(srv.URL)
+
+	info = api.VersionInfo{Version: "1.0.0", APIVersion: api.APIVersion}
+	assert.Empty(t, serverCompatibilityWarning(context.Background(), serverAddr))
+
+	info.APIVersion = api.APIVersion + 1
+	assert.Contains(t, serverCompatibilityWarning(context.Background(), serverAddr), "Please upgrade KeyConjurer")
+
+	info.APIVersion = api.APIVersion - 1
+	assert.Contains(t, serverCompatibilityWarning(context.Background(), serverAddr), "Some features may be unavailable")
+}
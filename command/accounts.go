@@ -2,28 +2,38 @@ package command
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"log/slog"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/riotgames/key-conjurer/internal/api"
+	"github.com/riotgames/key-conjurer/internal/apiclient"
 	"github.com/spf13/cobra"
 	"golang.org/x/oauth2"
 )
 
 var (
-	FlagNoRefresh     = "no-refresh"
-	FlagServerAddress = "server-address"
+	FlagNoRefresh      = "no-refresh"
+	FlagServerAddress  = "server-address"
+	FlagPreviewAliases = "preview-aliases"
+	FlagAccountsMaxAge = "accounts-max-age"
 
 	ErrSessionExpired = errors.New("session expired")
 )
 
+// serverVersionTimeout bounds how long the accounts command waits for the account server to report its version.
+const serverVersionTimeout = 2 * time.Second
+
 func init() {
 	accountsCmd.Flags().Bool(FlagNoRefresh, false, "Indicate that the account list should not be refreshed when executing this command. This is useful if you're not able to reach the account server.")
 	accountsCmd.Flags().String(FlagServerAddress, ServerAddress, "The address of the account server. This does not usually need to be changed or specified.")
+	accountsCmd.Flags().Bool(FlagLogin, false, "Login to Okta and try again if your session has expired")
+	accountsCmd.Flags().Bool(FlagPreviewAliases, false, "Print the aliases your alias rules would generate for each account without changing your account cache.")
 }
 
 var accountsCmd = &cobra.Command{
@@ -33,13 +43,25 @@ var accountsCmd = &cobra.Command{
 		config := ConfigFromCommand(cmd)
 		stdOut := cmd.OutOrStdout()
 		noRefresh, _ := cmd.Flags().GetBool(FlagNoRefresh)
+		previewAliases, _ := cmd.Flags().GetBool(FlagPreviewAliases)
+		login, _ := cmd.Flags().GetBool(FlagLogin)
+		oidcDomain, _ := cmd.Flags().GetString(FlagOIDCDomain)
+		clientID, _ := cmd.Flags().GetString(FlagClientID)
 		loud := !ShouldUseMachineOutput(cmd.Flags())
+		if noRefresh && previewAliases {
+			var accounts []Account
+			config.Accounts.ForEach(func(_ string, acc Account, _ string) {
+				accounts = append(accounts, acc)
+			})
+			return writeAliasPreview(stdOut, config, accounts, loud)
+		}
+
 		if noRefresh {
 			config.DumpAccounts(stdOut, loud)
 
 			if loud {
 				// intentionally uses PrintErrf was a warning
-				cmd.PrintErrf("--%s was specified - these results may be out of date, and you may not have access to accounts in this list.\n", FlagNoRefresh)
+				cmd.PrintErrf("--%s was specified - these results were %s and you may not have access to accounts in this list.\n", FlagNoRefresh, config.describeAccountsAge(time.Now()))
 			}
 
 			return nil
@@ -54,51 +76,122 @@ var accountsCmd = &cobra.Command{
 			}
 		}
 
-		accounts, err := refreshAccounts(cmd.Context(), serverAddrURI, &keychainTokenSource{})
+		accounts, err := refreshAccounts(cmd.Context(), serverAddrURI, &keychainTokenSource{}, config.AliasRules)
+		if errors.Is(err, ErrTokensExpiredOrAbsent) && login {
+			loginCommand := LoginCommand{
+				OIDCDomain:    oidcDomain,
+				ClientID:      clientID,
+				MachineOutput: !loud,
+			}
+			if err := loginCommand.Execute(cmd.Context(), config); err != nil {
+				return err
+			}
+			accounts, err = refreshAccounts(cmd.Context(), serverAddrURI, &keychainTokenSource{}, config.AliasRules)
+		}
+
+		if err != nil && isUnavailableError(err) && !previewAliases && len(config.Accounts.accounts) > 0 {
+			config.DumpAccounts(stdOut, loud)
+			if loud {
+				cmd.PrintErrf("Could not reach the account server (%s) - showing cached accounts %s.\n", err, config.describeAccountsAge(time.Now()))
+			}
+			return nil
+		}
+
 		if err != nil {
 			return fmt.Errorf("error refreshing accounts: %w", err)
 		}
 
-		config.UpdateAccounts(accounts)
+		if previewAliases {
+			return writeAliasPreview(stdOut, config, accounts, loud)
+		}
+
+		refreshedBefore := config.AccountsRefreshedAt != nil
+		diff := config.UpdateAccounts(accounts)
 		config.DumpAccounts(stdOut, loud)
+		if loud && refreshedBefore && !diff.Empty() {
+			cmd.PrintErrln("Changes since the last refresh:")
+			diff.Write(cmd.ErrOrStderr())
+		}
+
+		if loud {
+			if warning := serverCompatibilityWarning(cmd.Context(), serverAddrURI); warning != "" {
+				cmd.PrintErrln(warning)
+			}
+		}
 		return nil
 	},
 }
 
-func refreshAccounts(ctx context.Context, serverAddr *url.URL, ts oauth2.TokenSource) ([]Account, error) {
-	client := oauth2.NewClient(ctx, ts)
-	uri := serverAddr.ResolveReference(&url.URL{Path: "/v2/applications"})
-	req, _ := http.NewRequestWithContext(ctx, "POST", uri.String(), nil)
-	resp, err := client.Do(req)
+// serverCompatibilityWarning returns a warning if the account server uses a different version of the API to this version of KeyConjurer, or an empty string if it does not or its version cannot be determined.
+func serverCompatibilityWarning(ctx context.Context, serverAddr *url.URL) string {
+	ctx, cancel := context.WithTimeout(ctx, serverVersionTimeout)
+	defer cancel()
+
+	// The version endpoint does not require authentication.
+	client := apiclient.New(ctx, serverAddr, nil)
+	client.MaxRetries = 0
+	info, err := client.Version(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to issue request: %s", err)
+		slog.Debug("could not fetch account server version", slog.String("error", err.Error()))
+		return ""
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("could not read body: %s", err)
+	switch {
+	case info.APIVersion > api.APIVersion:
+		return fmt.Sprintf("The account server (version %s) uses a newer API than this version of KeyConjurer (%s). Please upgrade KeyConjurer.", info.Version, Version)
+	case info.APIVersion < api.APIVersion:
+		return fmt.Sprintf("The account server (version %s) uses an older API than this version of KeyConjurer (%s). Some features may be unavailable.", info.Version, Version)
 	}
 
-	var jsonError api.JSONError
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != 0 {
-		if err := json.Unmarshal(body, &jsonError); err != nil {
-			return nil, errors.New(jsonError.Message)
+	return ""
+}
+
+// writeAliasPreview prints the alias that would be generated for each account alongside the aliases the account currently has, if it is in the account cache.
+func writeAliasPreview(w io.Writer, config *Config, accounts []Account, withHeaders bool) error {
+	tbl := csv.NewWriter(w)
+	tbl.Comma = '\t'
+	if withHeaders {
+		tbl.Write([]string{"id", "name", "current alias", "generated alias"})
+	}
+
+	for _, acc := range accounts {
+		generated, err := config.AliasRules.Alias(acc.ID, acc.Name)
+		if err != nil {
+			return err
+		}
 
+		var current string
+		if existing, ok := config.Accounts.accounts[acc.ID]; ok {
+			current = strings.Join(existing.Aliases, ",")
 		}
-		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+
+		tbl.Write([]string{acc.ID, acc.Name, current, generated})
 	}
 
-	var apps []api.Application
-	if err := json.Unmarshal(body, &apps); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal applications: %w", err)
+	tbl.Flush()
+	return tbl.Error()
+}
+
+func refreshAccounts(ctx context.Context, serverAddr *url.URL, ts oauth2.TokenSource, rules *AliasRules) ([]Account, error) {
+	apps, err := apiclient.New(ctx, serverAddr, ts).ListApplications(ctx)
+	if errors.Is(err, apiclient.ErrUnauthorized) {
+		return nil, ErrTokensExpiredOrAbsent
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
 	entries := make([]Account, len(apps))
 	for idx, app := range apps {
-		entries[idx] = Account{
-			ID:    app.ID,
-			Name:  app.Name,
-			Alias: generateDefaultAlias(app.Name),
+		alias, err := rules.Alias(app.ID, app.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		entries[idx] = Account{ID: app.ID, Name: app.Name, Type: app.Type}
+		if alias != "" {
+			entries[idx].Aliases = []string{alias}
 		}
 	}
 
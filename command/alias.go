@@ -1,16 +1,76 @@
 package command
 
 import (
+	"encoding/csv"
+	"fmt"
+	"slices"
+
 	"github.com/spf13/cobra"
 )
 
+func init() {
+	aliasListCmd.Flags().StringP(FlagOutputType, "o", outputTypeText, "Format to print aliases in. Supported outputs: text, json")
+	aliasListCmd.Flags().SetAnnotation(FlagOutputType, annotationNoEnvironment, []string{"true"})
+	aliasCmd.AddCommand(aliasListCmd)
+}
+
 var aliasCmd = cobra.Command{
-	Use:     "alias <accountName> <alias>",
-	Short:   "Give an account a nickname.",
-	Long:    "Alias an account to a nickname so you can refer to the account by the nickname.",
+	Use:   "alias <accountName> <alias>",
+	Short: "Give an account a nickname.",
+	Long: `Alias an account to a nickname so you can refer to the account by the nickname.
+
+An account may have more than one alias. An alias cannot be the same as the ID, name or alias of a different account.`,
 	Args:    cobra.ExactArgs(2),
 	Example: "keyconjurer alias FooAccount Bar",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := ConfigFromCommand(cmd)
-		config.Alias(args[0], args[1])
+		return config.Alias(args[0], args[1])
 	}}
+
+// aliasEntry is the JSON representation of an account's aliases.
+type aliasEntry struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the aliases of every account.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		outputType, _ := cmd.Flags().GetString(FlagOutputType)
+		if !slices.Contains(permittedConfigOutputTypes, outputType) {
+			return ValueError{Value: outputType, ValidValues: permittedConfigOutputTypes}
+		}
+
+		entries := []aliasEntry{}
+		ConfigFromCommand(cmd).Accounts.ForEach(func(id string, acc Account, _ string) {
+			if len(acc.Aliases) > 0 {
+				entries = append(entries, aliasEntry{ID: id, Name: acc.Name, Aliases: acc.Aliases})
+			}
+		})
+
+		if outputType == outputTypeJSON {
+			return writeJSON(cmd.OutOrStdout(), entries)
+		}
+
+		tbl := csv.NewWriter(cmd.OutOrStdout())
+		tbl.Comma = '\t'
+		if !ShouldUseMachineOutput(cmd.Flags()) {
+			tbl.Write([]string{"alias", "id", "name"})
+		}
+
+		for _, entry := range entries {
+			for _, alias := range entry.Aliases {
+				tbl.Write([]string{alias, entry.ID, entry.Name})
+			}
+		}
+
+		tbl.Flush()
+		if err := tbl.Error(); err != nil {
+			return fmt.Errorf("write aliases: %w", err)
+		}
+		return nil
+	},
+}
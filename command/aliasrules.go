@@ -0,0 +1,141 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// AliasRewrite replaces every match of Pattern, a regular expression, with Replacement, which may refer to capture groups using $1 or ${name}.
+type AliasRewrite struct {
+	Pattern     string `json:"pattern" yaml:"pattern"`
+	Replacement string `json:"replacement" yaml:"replacement"`
+}
+
+// AliasRules control how account names are normalized and how aliases are generated for accounts that are new to the account cache.
+//
+// A name is normalized by removing the first matching prefix in StripPrefixes, then the first matching suffix in StripSuffixes, then applying each of Rewrites in turn.
+// The alias is the normalized name, or the result of Template if one is given, converted to lowercase with spaces replaced with hyphens.
+type AliasRules struct {
+	StripPrefixes []string       `json:"strip_prefixes,omitempty" yaml:"strip_prefixes,omitempty"`
+	StripSuffixes []string       `json:"strip_suffixes,omitempty" yaml:"strip_suffixes,omitempty"`
+	Rewrites      []AliasRewrite `json:"rewrites,omitempty" yaml:"rewrites,omitempty"`
+	// Template is a text/template that can refer to {{.ID}}, {{.Name}} and {{.Normalized}}.
+	Template string `json:"template,omitempty" yaml:"template,omitempty"`
+
+	// rewrites are the compiled Rewrites, set by Validate so that the patterns are not compiled again for every account.
+	rewrites []compiledRewrite
+}
+
+type compiledRewrite struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// defaultAliasRules are used when the user has not configured any rules of their own.
+var defaultAliasRules = AliasRules{
+	StripPrefixes: []string{"AWS -"},
+}
+
+// aliasTemplateData is the data available to AliasRules.Template.
+type aliasTemplateData struct {
+	ID         string
+	Name       string
+	Normalized string
+}
+
+func (r *AliasRules) orDefault() *AliasRules {
+	if r == nil {
+		return &defaultAliasRules
+	}
+	return r
+}
+
+// Validate checks that the regular expressions and template in the rules are valid, and keeps the compiled regular expressions for use by Normalize.
+func (r *AliasRules) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	rewrites, err := compileRewrites(r.Rewrites)
+	r.rewrites = rewrites
+	if err != nil {
+		return err
+	}
+
+	if r.Template != "" {
+		if _, err := template.New("alias").Option("missingkey=error").Parse(r.Template); err != nil {
+			return fmt.Errorf("alias template: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// compileRewrites compiles the patterns of rewrites. Any invalid patterns are left out of the result, and the first is reported as an error.
+func compileRewrites(rewrites []AliasRewrite) ([]compiledRewrite, error) {
+	var compiled []compiledRewrite
+	var firstErr error
+	for _, rewrite := range rewrites {
+		re, err := regexp.Compile(rewrite.Pattern)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("alias rewrite %q: %w", rewrite.Pattern, err)
+			}
+			continue
+		}
+		compiled = append(compiled, compiledRewrite{re: re, replacement: rewrite.Replacement})
+	}
+	return compiled, firstErr
+}
+
+// Normalize removes decoration, such as a common prefix, from an account name.
+func (r *AliasRules) Normalize(name string) string {
+	r = r.orDefault()
+	for _, prefix := range r.StripPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			name = strings.TrimSpace(strings.TrimPrefix(name, prefix))
+			break
+		}
+	}
+
+	for _, suffix := range r.StripSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSpace(strings.TrimSuffix(name, suffix))
+			break
+		}
+	}
+
+	rewrites := r.rewrites
+	if len(rewrites) != len(r.Rewrites) {
+		// The rules have not been validated. Invalid patterns are ignored rather than breaking account lookups.
+		rewrites, _ = compileRewrites(r.Rewrites)
+	}
+
+	for _, rewrite := range rewrites {
+		name = rewrite.re.ReplaceAllString(name, rewrite.replacement)
+	}
+
+	return strings.TrimSpace(name)
+}
+
+// Alias generates an alias for the account with the given ID and name.
+func (r *AliasRules) Alias(id, name string) (string, error) {
+	r = r.orDefault()
+	alias := r.Normalize(name)
+	if r.Template != "" {
+		tmpl, err := template.New("alias").Option("missingkey=error").Parse(r.Template)
+		if err != nil {
+			return "", fmt.Errorf("alias template: %w", err)
+		}
+
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, aliasTemplateData{ID: id, Name: name, Normalized: alias}); err != nil {
+			return "", fmt.Errorf("alias template: %w", err)
+		}
+		alias = strings.TrimSpace(sb.String())
+	}
+
+	return strings.ToLower(strings.Join(strings.Fields(alias), "-")), nil
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliasRules(t *testing.T) {
+	rules := &AliasRules{
+		StripPrefixes: []string{"[AWS]", "AWS -"},
+		StripSuffixes: []string{"(legacy)"},
+		Rewrites:      []AliasRewrite{{Pattern: `\s+-\s+`, Replacement: "-"}},
+	}
+	require.NoError(t, rules.Validate())
+
+	assert.Equal(t, "Team-Env", rules.Normalize("[AWS] Team - Env"))
+	assert.Equal(t, "Team-Env", rules.Normalize("AWS - Team - Env (legacy)"))
+
+	alias, err := rules.Alias("123", "[AWS] Team - Prod")
+	require.NoError(t, err)
+	assert.Equal(t, "team-prod", alias)
+
+	rules.Template = "{{.Normalized}}-{{.ID}}"
+	alias, err = rules.Alias("123", "[AWS] Team - Prod")
+	require.NoError(t, err)
+	assert.Equal(t, "team-prod-123", alias)
+}
+
+func TestAliasRulesDefaultsMatchLegacyBehaviour(t *testing.T) {
+	var rules *AliasRules
+	alias, err := rules.Alias("1", "AWS - Foo Bar")
+	require.NoError(t, err)
+	assert.Equal(t, "foo-bar", alias)
+	assert.Equal(t, "Foo Bar", rules.Normalize("AWS - Foo Bar"))
+}
+
+func TestAliasRulesValidate(t *testing.T) {
+	assert.Error(t, (&AliasRules{Rewrites: []AliasRewrite{{Pattern: "("}}}).Validate())
+	assert.Error(t, (&AliasRules{Template: "{{.Normalized"}).Validate())
+
+	_, err := (&AliasRules{Template: "{{.Missing}}"}).Alias("1", "name")
+	assert.Error(t, err)
+}
+
+func TestAccountSetUsesConfiguredAliasRules(t *testing.T) {
+	config := Config{AliasRules: &AliasRules{StripPrefixes: []string{"[AWS]"}}}
+	config.AddAccount("1", Account{ID: "1", Name: "[AWS] Team"})
+
+	acc, err := config.ResolveAccount("team")
+	require.NoError(t, err)
+	assert.Equal(t, "1", acc.ID)
+}
+
+func TestDecodeCompilesAliasRewrites(t *testing.T) {
+	var config Config
+	require.NoError(t, config.Decode(strings.NewReader(`{"alias_rules":{"rewrites":[{"pattern":"\\s+-\\s+","replacement":"-"},{"pattern":"(","replacement":""}]}}`)))
+	assert.Len(t, config.AliasRules.rewrites, 1, "valid patterns should be compiled when the config is read")
+	assert.Equal(t, "Team-Env", config.AliasRules.Normalize("Team - Env"), "invalid patterns should be ignored")
+}
@@ -0,0 +1,74 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/RobotsAndPencils/go-saml"
+	"github.com/riotgames/key-conjurer/pkg/oauth2cli"
+	"github.com/spf13/pflag"
+)
+
+var (
+	FlagAssertionProvider = "assertion-provider"
+	FlagAssertionURL      = "assertion-url"
+)
+
+var (
+	// assertionProviderOkta retrieves SAML assertions using Okta's web SSO flow.
+	assertionProviderOkta = "okta"
+	// assertionProviderHTTP retrieves SAML assertions from the URL given by --assertion-url, presenting the user's access token as a bearer token.
+	assertionProviderHTTP       = "http"
+	permittedAssertionProviders = []string{assertionProviderOkta, assertionProviderHTTP}
+)
+
+func init() {
+	rootCmd.PersistentFlags().String(FlagAssertionProvider, assertionProviderOkta, "How SAML assertions are retrieved from your identity provider. Supported providers: okta, http")
+	rootCmd.PersistentFlags().String(FlagAssertionURL, "", "If the assertion provider is http, the URL to retrieve SAML assertions from. {application} is replaced with the ID of the application.")
+	rootCmd.PersistentFlags().MarkHidden(FlagAssertionProvider)
+	rootCmd.PersistentFlags().MarkHidden(FlagAssertionURL)
+}
+
+// assertionSettings are the settings needed to create an oauth2cli.AssertionProvider.
+type assertionSettings struct {
+	Provider, URL, OIDCDomain, ClientID string
+}
+
+func assertionSettingsFromFlags(flags *pflag.FlagSet) assertionSettings {
+	var s assertionSettings
+	s.Provider, _ = flags.GetString(FlagAssertionProvider)
+	s.URL, _ = flags.GetString(FlagAssertionURL)
+	s.OIDCDomain, _ = flags.GetString(FlagOIDCDomain)
+	s.ClientID, _ = flags.GetString(FlagClientID)
+	return s
+}
+
+// AssertionProvider returns the provider used to exchange the user's tokens for SAML assertions.
+//
+// Support for a new identity provider is added here; commands which need assertions do not need to change.
+func (s assertionSettings) AssertionProvider() (oauth2cli.AssertionProvider, error) {
+	switch s.Provider {
+	case "", assertionProviderOkta:
+		return oauth2cli.OktaAssertionProvider{OIDCDomain: s.OIDCDomain, ClientID: s.ClientID}, nil
+	case assertionProviderHTTP:
+		if u, err := url.Parse(s.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, genericError{
+				Message:  fmt.Sprintf("--%s must be an absolute URL when --%s is %s, got %q", FlagAssertionURL, FlagAssertionProvider, assertionProviderHTTP, s.URL),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+		return oauth2cli.HTTPAssertionProvider{URL: s.URL}, nil
+	default:
+		return nil, ValueError{Value: s.Provider, ValidValues: permittedAssertionProviders}
+	}
+}
+
+// exchangeTokenForAssertion retrieves a SAML assertion for the application with the given ID using the tokens stored in the keychain.
+func exchangeTokenForAssertion(ctx context.Context, provider oauth2cli.AssertionProvider, applicationID string) (*saml.Response, string, error) {
+	response, assertion, err := oauth2cli.ExchangeTokenForAssertion(ctx, provider, &keychainTokenSource{}, applicationID)
+	if err != nil {
+		return nil, "", webSSOError(err, applicationID)
+	}
+	return response, assertion, nil
+}
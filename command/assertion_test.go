@@ -0,0 +1,25 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/riotgames/key-conjurer/pkg/oauth2cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertionProvider(t *testing.T) {
+	provider, err := assertionSettings{OIDCDomain: "https://example.okta.com", ClientID: "client"}.AssertionProvider()
+	require.NoError(t, err)
+	assert.Equal(t, oauth2cli.OktaAssertionProvider{OIDCDomain: "https://example.okta.com", ClientID: "client"}, provider, "okta should be used by default")
+
+	provider, err = assertionSettings{Provider: "http", URL: "https://idp.example.com/saml/{application}"}.AssertionProvider()
+	require.NoError(t, err)
+	assert.Equal(t, oauth2cli.HTTPAssertionProvider{URL: "https://idp.example.com/saml/{application}"}, provider)
+
+	_, err = assertionSettings{Provider: "http"}.AssertionProvider()
+	assert.Error(t, err, "the http provider requires a URL")
+
+	_, err = assertionSettings{Provider: "keycloak"}.AssertionProvider()
+	assert.ErrorAs(t, err, &ValueError{})
+}
@@ -19,8 +19,8 @@ type CloudCliEntry struct {
 
 func NewCloudCliEntry(c CloudCredentials, a *Account) CloudCliEntry {
 	name := a.Name
-	if a.Alias != "" {
-		name = a.Alias
+	if alias := a.PrimaryAlias(); alias != "" {
+		name = alias
 	}
 
 	return CloudCliEntry{
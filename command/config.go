@@ -1,6 +1,7 @@
 package command
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
@@ -8,26 +9,163 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
-
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Account struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Alias          string `json:"alias"`
-	MostRecentRole string `json:"most_recent_role"`
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Aliases        []string `json:"aliases,omitempty"`
+	MostRecentRole string   `json:"most_recent_role"`
+	// Type is the kind of application the account server reported the account to be, such as amazon_aws.
+	Type string `json:"type,omitempty"`
+
+	// The following settings are used by the get command when the corresponding flag is not given.
+	DefaultRole string `json:"default_role,omitempty"`
+	Region      string `json:"region,omitempty"`
+	TTL         uint   `json:"ttl,omitempty"`
+	OutputType  string `json:"output,omitempty"`
+	ShellType   string `json:"shell,omitempty"`
+	AWSProfile  string `json:"profile,omitempty"`
+
+	// Federation is how credentials are retrieved for the account; see permittedFederations. SAML is used if it is empty.
+	Federation string `json:"federation,omitempty"`
+	// RoleARN is the role assumed when Federation is oidc.
+	RoleARN string `json:"role_arn,omitempty"`
+
+	// Tags are free-form labels used to organise accounts.
+	Tags []string `json:"tags,omitempty"`
 }
 
-func (a *Account) NormalizeName() string {
-	magicPrefixes := []string{"AWS - "}
-	name := a.Name
-	for _, prefix := range magicPrefixes {
-		name = strings.TrimPrefix(name, prefix)
+var (
+	accountSettingRole       = "role"
+	accountSettingRegion     = "region"
+	accountSettingTTL        = "ttl"
+	accountSettingOutputType = "output"
+	accountSettingShellType  = "shell"
+	accountSettingAWSProfile = "profile"
+	accountSettingTags       = "tags"
+	accountSettingFederation = "federation"
+	accountSettingRoleARN    = "role-arn"
+	accountSettings          = []string{accountSettingRole, accountSettingRegion, accountSettingTTL, accountSettingOutputType, accountSettingShellType, accountSettingAWSProfile, accountSettingTags, accountSettingFederation, accountSettingRoleARN}
+)
+
+// accountJSON has the same fields as Account, but none of its methods, which avoids infinite recursion when marshalling.
+type accountJSON Account
+
+// MarshalJSON writes the first alias to the legacy alias field as well as the aliases field so older versions of KeyConjurer can still read it.
+func (a Account) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		accountJSON
+		Alias string `json:"alias"`
+	}{accountJSON(a), a.PrimaryAlias()})
+}
+
+// UnmarshalJSON reads the legacy alias field written by older versions of KeyConjurer into Aliases.
+func (a *Account) UnmarshalJSON(buf []byte) error {
+	var v struct {
+		accountJSON
+		Alias string `json:"alias"`
+	}
+
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+
+	*a = Account(v.accountJSON)
+	if v.Alias != "" && !slices.Contains(a.Aliases, v.Alias) {
+		a.Aliases = append([]string{v.Alias}, a.Aliases...)
+	}
+
+	return nil
+}
+
+// PrimaryAlias returns the first alias given to the account, or an empty string if it has none.
+func (a *Account) PrimaryAlias() string {
+	if len(a.Aliases) == 0 {
+		return ""
+	}
+	return a.Aliases[0]
+}
+
+// HasAlias reports whether the account has the given alias.
+func (a *Account) HasAlias(alias string) bool {
+	return slices.Contains(a.Aliases, alias)
+}
+
+// SetSetting changes the per-account setting named key to value.
+//
+// An empty value removes the setting, causing the default to be used instead.
+func (a *Account) SetSetting(key, value string) error {
+	switch key {
+	case accountSettingRole:
+		a.DefaultRole = value
+	case accountSettingRegion:
+		a.Region = value
+	case accountSettingTTL:
+		if value == "" {
+			a.TTL = 0
+			return nil
+		}
+
+		ttl, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("unable to parse value %s", value)
+		}
+		a.TTL = uint(ttl)
+	case accountSettingOutputType:
+		if value != "" && !slices.Contains(permittedOutputTypes, value) {
+			return ValueError{Value: value, ValidValues: permittedOutputTypes}
+		}
+		a.OutputType = value
+	case accountSettingShellType:
+		if value != "" && !slices.Contains(permittedShellTypes, value) {
+			return ValueError{Value: value, ValidValues: permittedShellTypes}
+		}
+		a.ShellType = value
+	case accountSettingAWSProfile:
+		a.AWSProfile = value
+	case accountSettingTags:
+		a.Tags = splitTags(value)
+	case accountSettingFederation:
+		if value != "" && !slices.Contains(permittedFederations, value) {
+			return ValueError{Value: value, ValidValues: permittedFederations}
+		}
+		a.Federation = value
+	case accountSettingRoleARN:
+		if value != "" && !strings.HasPrefix(value, "arn:") {
+			return genericError{
+				Message:  fmt.Sprintf("%s must be an IAM role ARN such as arn:aws:iam::123456789012:role/Admin, got %q", accountSettingRoleARN, value),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+		a.RoleARN = value
+	default:
+		return ValueError{Value: key, ValidValues: accountSettings}
 	}
 
-	return name
+	return nil
+}
+
+// splitTags splits a comma-separated list of tags, discarding empty entries.
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// NormalizeName returns the name of the account with the decoration removed by the default alias rules.
+func (a *Account) NormalizeName() string {
+	return defaultAliasRules.Normalize(a.Name)
 }
 
 func (a *Account) IsNameMatch(name string) bool {
@@ -41,25 +179,23 @@ func (a *Account) IsNameMatch(name string) bool {
 		return true
 	}
 
-	if a.Alias == name {
-		return true
-	}
-
-	return false
+	return a.HasAlias(name)
 }
 
 type accountSet struct {
 	accounts map[string]*Account
+	// rules are the alias rules used to normalize account names. nil means the default rules are used.
+	rules *AliasRules
 }
 
-func generateDefaultAlias(name string) string {
-	magicPrefixes := []string{"AWS -"}
-	for _, prefix := range magicPrefixes {
-		name = strings.TrimPrefix(name, prefix)
-		name = strings.TrimSpace(name)
-	}
+// normalize returns the normalized name of the given account according to the alias rules of the set.
+func (a accountSet) normalize(acc *Account) string {
+	return a.rules.Normalize(acc.Name)
+}
 
-	return strings.ToLower(strings.ReplaceAll(name, " ", "-"))
+func generateDefaultAlias(name string) string {
+	alias, _ := defaultAliasRules.Alias("", name)
+	return alias
 }
 
 func (a *accountSet) ForEach(f func(id string, account Account, alias string)) {
@@ -74,7 +210,7 @@ func (a *accountSet) ForEach(f func(id string, account Account, alias string)) {
 	})
 
 	for _, acc := range accounts {
-		f(acc.ID, *acc, acc.Alias)
+		f(acc.ID, *acc, acc.PrimaryAlias())
 	}
 }
 
@@ -88,40 +224,75 @@ func (a *accountSet) Add(id string, account Account) {
 	a.accounts[id] = &account
 }
 
-// Unalias will remove all aliases for an account that matches the given name or given alias.
-func (a *accountSet) Unalias(name string) bool {
-	for _, acc := range a.accounts {
-		if acc.IsNameMatch(name) {
-			acc.Alias = ""
-			return true
+// Unalias removes aliases, returning the aliases that were removed.
+//
+// If name is an alias, only that alias is removed. Otherwise, all aliases are removed from the account with the given name or ID.
+func (a *accountSet) Unalias(name string) []string {
+	for _, id := range a.sortedIDs() {
+		acc := a.accounts[id]
+		if idx := slices.Index(acc.Aliases, name); idx != -1 {
+			acc.Aliases = slices.Delete(acc.Aliases, idx, idx+1)
+			return []string{name}
+		}
+	}
+
+	for _, id := range a.sortedIDs() {
+		acc := a.accounts[id]
+		if id == name || strings.EqualFold(acc.Name, name) || strings.EqualFold(a.normalize(acc), name) {
+			removed := acc.Aliases
+			acc.Aliases = nil
+			return removed
 		}
 	}
 
-	return false
+	return nil
 }
 
+// Resolve finds the account referred to by name, returning false if there is no such account or name is ambiguous.
+//
+// See Find for how accounts are matched.
 func (a accountSet) Resolve(name string) (*Account, bool) {
-	for k, acc := range a.accounts {
-		if k == name {
-			return acc, true
+	acc, err := a.Find(name)
+	return acc, err == nil
+}
+
+// aliasOwner returns the account, other than the one with the given ID, that the alias would be confused with.
+//
+// An alias cannot be the same as the ID, name or alias of any other account.
+func (a accountSet) aliasOwner(id, alias string) (*Account, bool) {
+	for _, otherID := range a.sortedIDs() {
+		other := a.accounts[otherID]
+		if otherID == id {
+			continue
 		}
 
-		if acc.IsNameMatch(name) {
-			return acc, true
+		if otherID == alias || other.HasAlias(alias) || strings.EqualFold(other.Name, alias) || strings.EqualFold(a.normalize(other), alias) {
+			return other, true
 		}
 	}
 
 	return nil, false
 }
 
-func (a accountSet) Alias(id, name string) bool {
+// Alias adds an alias to the account with the given ID.
+func (a accountSet) Alias(id, alias string) error {
 	entry, ok := a.accounts[id]
 	if !ok {
-		return false
+		return UnknownAccountError(id, FlagBypassCache)
+	}
+
+	if alias == "" {
+		return genericError{Message: "an alias cannot be empty", ExitCode: ExitCodeValueError}
 	}
 
-	entry.Alias = name
-	return true
+	if other, ok := a.aliasOwner(id, alias); ok {
+		return AliasCollisionError{Alias: alias, Account: other}
+	}
+
+	if !entry.HasAlias(alias) {
+		entry.Aliases = append(entry.Aliases, alias)
+	}
+	return nil
 }
 
 func (a *accountSet) MarshalJSON() ([]byte, error) {
@@ -143,30 +314,41 @@ func (a *accountSet) UnmarshalJSON(buf []byte) error {
 	return nil
 }
 
-func (a *accountSet) ReplaceWith(other []Account) {
+// ReplaceWith replaces the accounts in the set with other, preserving the aliases and settings of accounts which are in both, and returns what changed.
+func (a *accountSet) ReplaceWith(other []Account) accountDiff {
 	if a.accounts == nil {
 		a.accounts = make(map[string]*Account)
 	}
 
+	var diff accountDiff
 	m := map[string]struct{}{}
 	for _, acc := range other {
 		clone := acc
 		// Preserve the alias if the account ID is the same and it already exists
 		if entry, ok := a.accounts[acc.ID]; ok {
-			// The name is the only thing that might change.
+			// The name and type are the only things that might change.
+			if entry.Name != acc.Name {
+				diff.Renamed = append(diff.Renamed, accountRename{ID: acc.ID, From: entry.Name, To: acc.Name})
+			}
 			entry.Name = acc.Name
+			entry.Type = acc.Type
 		} else {
 			a.accounts[acc.ID] = &clone
+			diff.Added = append(diff.Added, clone)
 		}
 
 		m[acc.ID] = struct{}{}
 	}
 
-	for k := range a.accounts {
+	for k, acc := range a.accounts {
 		if _, ok := m[k]; !ok {
+			diff.Removed = append(diff.Removed, *acc)
 			delete(a.accounts, k)
 		}
 	}
+
+	diff.sort()
+	return diff
 }
 
 func (a accountSet) WriteTable(w io.Writer, withHeaders bool) {
@@ -174,11 +356,11 @@ func (a accountSet) WriteTable(w io.Writer, withHeaders bool) {
 	tbl.Comma = '\t'
 
 	if withHeaders {
-		tbl.Write([]string{"id", "name", "alias"})
+		tbl.Write([]string{"id", "name", "alias", "type"})
 	}
 
-	a.ForEach(func(id string, acc Account, alias string) {
-		tbl.Write([]string{id, acc.Name, alias})
+	a.ForEach(func(id string, acc Account, _ string) {
+		tbl.Write([]string{id, acc.Name, strings.Join(acc.Aliases, ","), acc.Type})
 	})
 
 	tbl.Flush()
@@ -190,11 +372,29 @@ type Config struct {
 	TTL             uint        `json:"ttl"`
 	TimeRemaining   uint        `json:"time_remaining"`
 	LastUsedAccount *string     `json:"last_used_account"`
+	OIDCDomain      string      `json:"oidc_domain,omitempty"`
+	ClientID        string      `json:"client_id,omitempty"`
+	ServerAddress   string      `json:"server_address,omitempty"`
+	AliasRules      *AliasRules `json:"alias_rules,omitempty"`
+	// AssertionProvider is how SAML assertions are retrieved; see permittedAssertionProviders.
+	AssertionProvider string `json:"assertion_provider,omitempty"`
+	// AssertionURL is where SAML assertions are retrieved from when AssertionProvider is http.
+	AssertionURL string `json:"assertion_url,omitempty"`
+	// AccountsRefreshedAt is when the account cache was last refreshed from the account server.
+	AccountsRefreshedAt *time.Time `json:"accounts_refreshed_at,omitempty"`
+	// AccountsRefreshAttemptedAt is when get last tried to refresh the account cache automatically, whether or not it succeeded.
+	AccountsRefreshAttemptedAt *time.Time `json:"accounts_refresh_attempted_at,omitempty"`
+	// AccountsMaxAge is how old, in hours, the account cache may be before it is refreshed automatically.
+	AccountsMaxAge uint `json:"accounts_max_age,omitempty"`
+
+	// loaded is the encoded form of the config at the time it was read from disk.
+	loaded []byte
 }
 
 // Encode writes the config to the file provided overwriting the file if it exists
 func (c *Config) Encode(w io.Writer) error {
 	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
 	return enc.Encode(c)
 }
 
@@ -211,37 +411,48 @@ func (c *Config) Decode(reader io.Reader) error {
 		c.Accounts = &accountSet{}
 	}
 
-	if c.TTL < 1 {
-		c.TTL = DefaultTTL
-	}
-
+	// Validating compiles the alias rules once, rather than every time an account name is normalized. Invalid rules are reported by Config.Validate.
+	_ = c.AliasRules.Validate()
+	c.Accounts.rules = c.AliasRules
 	return nil
 }
 
 func (c *Config) AddAccount(id string, account Account) {
 	if c.Accounts == nil {
-		c.Accounts = &accountSet{accounts: make(map[string]*Account)}
+		c.Accounts = &accountSet{accounts: make(map[string]*Account), rules: c.AliasRules}
 	}
 
 	c.Accounts.Add(id, account)
 }
 
-func (c *Config) Alias(id, name string) {
-	acc, ok := c.Accounts.Resolve(id)
-	if !ok {
-		return
+// Alias gives the account referred to by name an additional alias.
+func (c *Config) Alias(name, alias string) error {
+	acc, err := c.ResolveAccount(name)
+	if err != nil {
+		return err
 	}
 
-	acc.Alias = name
+	return c.Accounts.Alias(acc.ID, alias)
 }
 
-func (c *Config) Unalias(name string) {
-	acc, ok := c.Accounts.Resolve(name)
-	if !ok {
-		return
+// Unalias removes an alias, or all of the aliases of an account, returning the aliases that were removed.
+//
+// See accountSet.Unalias.
+func (c *Config) Unalias(name string) []string {
+	if c.Accounts == nil {
+		return nil
+	}
+
+	return c.Accounts.Unalias(name)
+}
+
+// ResolveAccount finds the account referred to by name, returning an error describing why if it could not be found.
+func (c *Config) ResolveAccount(name string) (*Account, error) {
+	if c.Accounts == nil {
+		return nil, UnknownAccountError(name, FlagBypassCache)
 	}
 
-	acc.Alias = ""
+	return c.Accounts.Find(name)
 }
 
 func (c *Config) FindAccount(name string) (*Account, bool) {
@@ -257,22 +468,17 @@ func (c *Config) FindAccount(name string) (*Account, bool) {
 	return &Account{}, false
 }
 
-func (c *Config) UpdateAccounts(entries []Account) {
-	c.Accounts.ReplaceWith(entries)
+// UpdateAccounts replaces the account cache with entries, records when it happened and returns what changed.
+func (c *Config) UpdateAccounts(entries []Account) accountDiff {
+	now := time.Now().UTC()
+	c.AccountsRefreshedAt = &now
+	return c.Accounts.ReplaceWith(entries)
 }
 
 func (c *Config) DumpAccounts(w io.Writer, withHeaders bool) {
 	c.Accounts.WriteTable(w, withHeaders)
 }
 
-func ensureConfigFileExists(fp string) (io.ReadWriteCloser, error) {
-	if err := os.MkdirAll(filepath.Dir(fp), os.ModeDir|os.FileMode(0755)); err != nil {
-		return nil, err
-	}
-
-	return os.OpenFile(fp, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-}
-
 func findConfigPath() (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
@@ -281,38 +487,276 @@ func findConfigPath() (string, error) {
 	return filepath.Join(dir, "keyconjurer", "config.json"), nil
 }
 
-func loadConfig() (Config, error) {
-	var config Config
-	path, err := findConfigPath()
+// withConfigLock runs f while holding an advisory lock on a file next to the config file at path.
+//
+// A separate lock file is used because the config file itself is replaced on every write, and a lock held on the old file would not prevent another process from reading the new one.
+func withConfigLock(path string, exclusive bool, f func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.FileMode(0700)); err != nil {
+		return err
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
-		return config, fmt.Errorf("find config path: %s", err)
+		return err
 	}
+	defer lock.Close()
+
+	if err := lockFile(lock, exclusive); err != nil {
+		return fmt.Errorf("lock %s: %w", lock.Name(), err)
+	}
+	defer unlockFile(lock)
+
+	return f()
+}
+
+// readConfig reads the config stored at path. A missing file is treated the same as an empty one.
+func readConfig(path string) (Config, error) {
+	var config Config
+	err := withConfigLock(path, false, func() error {
+		buf, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
 
-	file, err := ensureConfigFileExists(path)
+		return config.Decode(bytes.NewReader(buf))
+	})
 	if err != nil {
 		return config, err
 	}
 
-	err = config.Decode(file)
-	return config, err
+	// Remember what the config looked like when we read it so that writeConfig can skip writing it back if nothing changed.
+	var buf bytes.Buffer
+	if err := config.Encode(&buf); err != nil {
+		return config, err
+	}
+	config.loaded = buf.Bytes()
+	return config, nil
 }
 
-func saveConfig(config *Config) error {
-	path, err := findConfigPath()
-	if err != nil {
-		return fmt.Errorf("find config path: %s", err)
+// writeConfig atomically replaces the config stored at path.
+//
+// The file is only written if the config has changed since it was read.
+// If another process changed the file in the meantime, the changes made to config since it was read are applied on top of the other process's changes rather than discarding them; see mergeJSON.
+// The new contents are written to a temporary file in the same directory which is then renamed over the old file, so readers never observe a partially written config.
+func writeConfig(path string, config *Config) error {
+	var buf bytes.Buffer
+	if err := config.Encode(&buf); err != nil {
+		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.FileMode(0755)); err != nil {
+	if config.loaded != nil && bytes.Equal(buf.Bytes(), config.loaded) {
+		return nil
+	}
+
+	return withConfigLock(path, true, func() error {
+		next, err := mergeConcurrentChanges(path, config, buf.Bytes())
+		if err != nil {
+			return err
+		}
+
+		// CreateTemp creates files with 0600 permissions, which is what we want as the config may contain account information.
+		f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("unable to create temporary file for %s reason: %w", path, err)
+		}
+
+		tmpPath := f.Name()
+		defer os.Remove(tmpPath)
+
+		if _, err := f.Write(next); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		if err := os.Rename(tmpPath, path); err != nil {
+			return fmt.Errorf("unable to replace %s reason: %w", path, err)
+		}
+
+		config.loaded = next
+		return nil
+	})
+}
+
+// readConfigUnlocked reads and re-encodes the config stored at path, so that it can be compared with Config.loaded. The caller must hold the config lock.
+func readConfigUnlocked(path string) ([]byte, error) {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var disk Config
+	if err := disk.Decode(bytes.NewReader(current)); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := disk.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// configChangedSince reports whether the config stored at path differs from loaded, the encoded form of a config that was read from it.
+func configChangedSince(path string, loaded []byte) (bool, error) {
+	var changed bool
+	err := withConfigLock(path, false, func() error {
+		current, err := readConfigUnlocked(path)
+		changed = !bytes.Equal(current, loaded)
 		return err
+	})
+	return changed, err
+}
+
+// mergeConcurrentChanges returns the contents that should be written to path, which are ours unless the file has changed since config was read.
+//
+// In that case the changes made to config are merged with the changes on disk and config is updated to match. The caller must hold the config lock exclusively.
+// If an alias added to config would be confused with another account after merging, an AliasCollisionError is returned and the file should be left as it is.
+func mergeConcurrentChanges(path string, config *Config, ours []byte) ([]byte, error) {
+	if config.loaded == nil {
+		return ours, nil
 	}
 
-	w, err := os.Create(path)
+	theirs, err := readConfigUnlocked(path)
 	if err != nil {
-		return fmt.Errorf("unable to create %s reason: %w", path, err)
+		return nil, err
+	}
+
+	if bytes.Equal(theirs, config.loaded) {
+		return ours, nil
+	}
+
+	var loaded Config
+	if err := loaded.Decode(bytes.NewReader(config.loaded)); err != nil {
+		return nil, err
+	}
+
+	var base, mine, other any
+	if err := json.Unmarshal(config.loaded, &base); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(ours, &mine); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(theirs, &other); err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergeJSON(base, mine, other))
+	if err != nil {
+		return nil, err
+	}
+
+	var next Config
+	if err := next.Decode(bytes.NewReader(merged)); err != nil {
+		return nil, err
+	}
+
+	// Each account is merged separately, so an alias added here may have been given to a different account concurrently.
+	if err := addedAliasCollision(loaded.Accounts, config.Accounts, next.Accounts); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := next.Encode(&buf); err != nil {
+		return nil, err
+	}
+
+	*config = next
+	return buf.Bytes(), nil
+}
+
+// addedAliasCollision returns an AliasCollisionError if an alias that was added to ours since base would be confused with another account in merged.
+func addedAliasCollision(base, ours, merged *accountSet) error {
+	if ours == nil {
+		return nil
+	}
+
+	for _, id := range ours.sortedIDs() {
+		before := base.accounts[id]
+		for _, alias := range ours.accounts[id].Aliases {
+			if before != nil && before.HasAlias(alias) {
+				continue
+			}
+
+			if other, ok := merged.aliasOwner(id, alias); ok {
+				return AliasCollisionError{Alias: alias, Account: other}
+			}
+		}
+	}
+
+	return nil
+}
+
+// missingJSON stands in for a key which is not present in a JSON object.
+type missingJSON struct{}
+
+// mergeJSON performs a three-way merge of decoded JSON values, applying the changes made between base and ours on top of theirs.
+//
+// Objects are merged key by key. Any other value which was changed by both sides takes the value from ours.
+func mergeJSON(base, ours, theirs any) any {
+	if reflect.DeepEqual(ours, base) {
+		return theirs
+	}
+
+	if reflect.DeepEqual(theirs, base) || reflect.DeepEqual(theirs, ours) {
+		return ours
+	}
+
+	o, oursIsObject := ours.(map[string]any)
+	t, theirsIsObject := theirs.(map[string]any)
+	if !oursIsObject || !theirsIsObject {
+		return ours
+	}
+
+	b, _ := base.(map[string]any)
+	keys := make(map[string]bool)
+	for _, m := range []map[string]any{b, o, t} {
+		for key := range m {
+			keys[key] = true
+		}
+	}
+
+	merged := make(map[string]any)
+	for key := range keys {
+		v := mergeJSON(lookupJSON(b, key), lookupJSON(o, key), lookupJSON(t, key))
+		if _, missing := v.(missingJSON); !missing {
+			merged[key] = v
+		}
+	}
+
+	return merged
+}
+
+func lookupJSON(m map[string]any, key string) any {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return missingJSON{}
+}
+
+func loadConfig() (Config, error) {
+	path, err := findConfigPath()
+	if err != nil {
+		return Config{}, fmt.Errorf("find config path: %s", err)
+	}
+
+	return readConfig(path)
+}
+
+func saveConfig(config *Config) error {
+	path, err := findConfigPath()
+	if err != nil {
+		return fmt.Errorf("find config path: %s", err)
 	}
-	defer w.Close()
 
-	err = config.Encode(w)
-	return err
+	return writeConfig(path, config)
 }
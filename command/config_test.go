@@ -1,10 +1,19 @@
 package command
 
 import (
+	"bytes"
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestFindAccount(t *testing.T) {
@@ -22,9 +31,9 @@ func TestFindAccount(t *testing.T) {
 func TestResolveCanResolveAliases(t *testing.T) {
 	set := accountSet{}
 	set.Add("1", Account{
-		ID:    "1",
-		Name:  "testaccount",
-		Alias: "totallyacoolalias",
+		ID:      "1",
+		Name:    "testaccount",
+		Aliases: []string{"totallyacoolalias"},
 	})
 
 	_, ok := set.Resolve("totallyacoolalias")
@@ -33,13 +42,13 @@ func TestResolveCanResolveAliases(t *testing.T) {
 
 func TestAccountFuncs(t *testing.T) {
 	test := &Account{
-		ID:    "12345",
-		Name:  "AWS - Test Account",
-		Alias: "secondalias",
+		ID:      "12345",
+		Name:    "AWS - Test Account",
+		Aliases: []string{"secondalias"},
 	}
 
 	assert.True(t, test.IsNameMatch("Test Account"))
-	assert.Truef(t, test.IsNameMatch("secondalias"), "Should be able to name match %s with alias %s", "secondalias", test.Alias)
+	assert.Truef(t, test.IsNameMatch("secondalias"), "Should be able to name match %s with alias %s", "secondalias", test.Aliases)
 	assert.Equal(t, test.NormalizeName(), "Test Account")
 }
 
@@ -52,7 +61,7 @@ func TestUnmarshalJSON(t *testing.T) {
 	acc, ok := c.Accounts.Resolve("name")
 	assert.True(t, ok)
 	assert.Equal(t, "AWS - name", acc.Name)
-	assert.Equal(t, "name", acc.Alias)
+	assert.Equal(t, []string{"name"}, acc.Aliases)
 	assert.Equal(t, "1", acc.ID)
 
 	assert.Equal(t, uint(0), c.TimeRemaining)
@@ -73,19 +82,19 @@ func TestConfigAliasesWork(t *testing.T) {
 	_, ok := cfg.FindAccount("alias")
 	assert.False(t, ok)
 
-	cfg.Alias("1234", "alias")
+	require.NoError(t, cfg.Alias("1234", "alias"))
 	_, ok = cfg.FindAccount("alias")
 	assert.True(t, ok)
 
-	cfg.Unalias("alias")
+	assert.Equal(t, []string{"alias"}, cfg.Unalias("alias"))
 	_, ok = cfg.FindAccount("alias")
 	assert.False(t, ok)
 }
 
 func TestAliasesPreservedAfterReplaceWith(t *testing.T) {
 	cfg := Config{}
-	cfg.AddAccount("riot-1", Account{ID: "riot-1", Name: "AWS - riot 1", Alias: "riot-1"})
-	cfg.Alias("riot-1", "my-alias")
+	cfg.AddAccount("riot-1", Account{ID: "riot-1", Name: "AWS - riot 1", Aliases: []string{"riot-1"}})
+	require.NoError(t, cfg.Alias("riot-1", "my-alias"))
 
 	_, ok := cfg.FindAccount("riot-1")
 	assert.True(t, ok)
@@ -93,8 +102,8 @@ func TestAliasesPreservedAfterReplaceWith(t *testing.T) {
 	assert.True(t, ok)
 
 	cfg.UpdateAccounts([]Account{
-		{ID: "riot-1", Name: "AWS - riot 1", Alias: ""},
-		{ID: "riot-2", Name: "AWS - riot 2", Alias: ""},
+		{ID: "riot-1", Name: "AWS - riot 1"},
+		{ID: "riot-2", Name: "AWS - riot 2"},
 	})
 
 	_, ok = cfg.FindAccount("riot-1")
@@ -105,7 +114,7 @@ func TestAliasesPreservedAfterReplaceWith(t *testing.T) {
 	assert.True(t, ok)
 
 	cfg.UpdateAccounts([]Account{
-		{ID: "riot-2", Name: "AWS - riot 2", Alias: ""},
+		{ID: "riot-2", Name: "AWS - riot 2"},
 	})
 
 	_, ok = cfg.FindAccount("riot-1")
@@ -126,3 +135,349 @@ func TestGeneratesGoodAliases(t *testing.T) {
 		assert.Equal(t, pair[1], generateDefaultAlias(pair[0]))
 	}
 }
+
+func TestWriteConfigRoundTrips(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyconjurer", "config.json")
+
+	config, err := readConfig(path)
+	require.NoError(t, err)
+	config.AddAccount("1", Account{ID: "1", Name: "AWS - name", Aliases: []string{"name"}})
+	config.TTL = 4
+	require.NoError(t, writeConfig(path, &config))
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	}
+
+	reread, err := readConfig(path)
+	require.NoError(t, err)
+	acc, ok := reread.FindAccount("name")
+	assert.True(t, ok)
+	assert.Equal(t, "1", acc.ID)
+	assert.Equal(t, uint(4), reread.TTL)
+}
+
+func TestWriteConfigSkipsUnchangedConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ttl":2}`), 0600))
+
+	config, err := readConfig(path)
+	require.NoError(t, err)
+	require.NoError(t, writeConfig(path, &config))
+
+	// The file should not have been rewritten as the config did not change.
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ttl":2}`, string(buf))
+
+	config.TTL = 3
+	require.NoError(t, writeConfig(path, &config))
+	reread, err := readConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, uint(3), reread.TTL)
+}
+
+func TestWriteConfigMergesConcurrentChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	initial, err := readConfig(path)
+	require.NoError(t, err)
+	initial.AddAccount("1", Account{ID: "1", Name: "one"})
+	initial.AddAccount("2", Account{ID: "2", Name: "two"})
+	require.NoError(t, writeConfig(path, &initial))
+
+	// Both processes read the same snapshot before either writes.
+	first, err := readConfig(path)
+	require.NoError(t, err)
+	second, err := readConfig(path)
+	require.NoError(t, err)
+
+	first.Accounts.accounts["1"].MostRecentRole = "Admin"
+	lastUsed := "1"
+	first.LastUsedAccount = &lastUsed
+	require.NoError(t, writeConfig(path, &first))
+
+	second.Accounts.accounts["2"].MostRecentRole = "ReadOnly"
+	second.AddAccount("3", Account{ID: "3", Name: "three"})
+	second.TTL = 4
+	require.NoError(t, writeConfig(path, &second))
+
+	reread, err := readConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Admin", reread.Accounts.accounts["1"].MostRecentRole, "the first write should not be lost")
+	assert.Equal(t, "1", *reread.LastUsedAccount)
+	assert.Equal(t, "ReadOnly", reread.Accounts.accounts["2"].MostRecentRole)
+	assert.Contains(t, reread.Accounts.accounts, "3")
+	assert.Equal(t, uint(4), reread.TTL)
+	assert.Equal(t, "Admin", second.Accounts.accounts["1"].MostRecentRole, "the in-memory config should reflect the merged file")
+}
+
+func TestWriteConfigRejectsConcurrentAliasCollisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	initial, err := readConfig(path)
+	require.NoError(t, err)
+	initial.AddAccount("1", Account{ID: "1", Name: "one"})
+	initial.AddAccount("2", Account{ID: "2", Name: "two"})
+	require.NoError(t, writeConfig(path, &initial))
+
+	first, err := readConfig(path)
+	require.NoError(t, err)
+	second, err := readConfig(path)
+	require.NoError(t, err)
+
+	require.NoError(t, first.Accounts.Alias("1", "prod"))
+	require.NoError(t, writeConfig(path, &first))
+
+	require.NoError(t, second.Accounts.Alias("2", "prod"), "the alias was free when the second process read the config")
+	var collisionErr AliasCollisionError
+	require.ErrorAs(t, writeConfig(path, &second), &collisionErr)
+	assert.Equal(t, "1", collisionErr.Account.ID)
+
+	reread, err := readConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prod"}, reread.Accounts.accounts["1"].Aliases)
+	assert.Empty(t, reread.Accounts.accounts["2"].Aliases, "the conflicting write should not have been saved")
+}
+
+func TestWriteConfigConcurrentReadModifyWriteCycles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	initial, err := readConfig(path)
+	require.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		id := strconv.Itoa(i)
+		initial.AddAccount(id, Account{ID: id, Name: "account " + id})
+	}
+	require.NoError(t, writeConfig(path, &initial))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			config, err := readConfig(path)
+			assert.NoError(t, err)
+			config.Accounts.accounts[id].MostRecentRole = "role " + id
+			assert.NoError(t, writeConfig(path, &config))
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+
+	reread, err := readConfig(path)
+	require.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		id := strconv.Itoa(i)
+		assert.Equal(t, "role "+id, reread.Accounts.accounts[id].MostRecentRole, "the change made by writer %s was lost", id)
+	}
+}
+
+func TestConfigChangedSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ttl":2}`), 0600))
+
+	config, err := readConfig(path)
+	require.NoError(t, err)
+	changed, err := configChangedSince(path, config.loaded)
+	require.NoError(t, err)
+	assert.False(t, changed, "a file which is only formatted differently has not changed")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"ttl":3}`), 0600))
+	changed, err = configChangedSince(path, config.loaded)
+	require.NoError(t, err)
+	assert.True(t, changed)
+}
+
+func TestWriteConfigConcurrentWritersDoNotCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 16; i++ {
+		wg.Add(1)
+		go func(ttl uint) {
+			defer wg.Done()
+			config, err := readConfig(path)
+			assert.NoError(t, err)
+			config.TTL = ttl
+			assert.NoError(t, writeConfig(path, &config))
+		}(uint(i))
+	}
+	wg.Wait()
+
+	_, err := readConfig(path)
+	require.NoError(t, err)
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches, "temporary files should be cleaned up")
+}
+
+func TestAccountSetSetting(t *testing.T) {
+	var acc Account
+	require.NoError(t, acc.SetSetting("role", "Admin"))
+	require.NoError(t, acc.SetSetting("region", "eu-west-1"))
+	require.NoError(t, acc.SetSetting("ttl", "4"))
+	require.NoError(t, acc.SetSetting("output", outputTypeAWSCredentialsFile))
+	require.NoError(t, acc.SetSetting("shell", shellTypeBash))
+	require.NoError(t, acc.SetSetting("profile", "prod"))
+	assert.Equal(t, Account{DefaultRole: "Admin", Region: "eu-west-1", TTL: 4, OutputType: "awscli", ShellType: "bash", AWSProfile: "prod"}, acc)
+
+	require.NoError(t, acc.SetSetting("ttl", ""))
+	assert.Equal(t, uint(0), acc.TTL)
+
+	var valueErr ValueError
+	assert.ErrorAs(t, acc.SetSetting("output", "yaml"), &valueErr)
+	assert.ErrorAs(t, acc.SetSetting("shell", "fish"), &valueErr)
+	assert.ErrorAs(t, acc.SetSetting("colour", "blue"), &valueErr)
+	assert.Error(t, acc.SetSetting("ttl", "forever"))
+
+	require.NoError(t, acc.SetSetting("federation", federationOIDC))
+	require.NoError(t, acc.SetSetting("role-arn", "arn:aws:iam::123456789012:role/Admin"))
+	assert.Equal(t, "oidc", acc.Federation)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/Admin", acc.RoleARN)
+	assert.ErrorAs(t, acc.SetSetting("federation", "kerberos"), &valueErr)
+	assert.Error(t, acc.SetSetting("role-arn", "Admin"))
+}
+
+func TestExportImportRoundTrips(t *testing.T) {
+	var source Config
+	source.ClientID = "client"
+	source.AddAccount("1", Account{ID: "1", Name: "AWS - one", Aliases: []string{"one"}, Tags: []string{"prod"}, DefaultRole: "Admin", TTL: 4})
+	source.AddAccount("2", Account{ID: "2", Name: "AWS - two", Aliases: []string{"two"}})
+	doc := source.Export()
+
+	var target Config
+	target.AddAccount("1", Account{ID: "1", Name: "AWS - one", MostRecentRole: "ReadOnly"})
+	require.NoError(t, target.Import(doc, keepConflicts))
+
+	acc, ok := target.FindAccount("one")
+	require.True(t, ok)
+	assert.Equal(t, Account{ID: "1", Name: "AWS - one", Aliases: []string{"one"}, MostRecentRole: "ReadOnly", Tags: []string{"prod"}, DefaultRole: "Admin", TTL: 4}, *acc)
+	_, ok = target.FindAccount("two")
+	assert.True(t, ok, "accounts missing from the config should be added")
+	assert.Equal(t, "client", target.ClientID)
+}
+
+func TestExportImportAliasRules(t *testing.T) {
+	var source Config
+	source.AliasRules = &AliasRules{StripPrefixes: []string{"Team -"}, Rewrites: []AliasRewrite{{Pattern: `\s+`, Replacement: "."}}}
+	source.AddAccount("1", Account{ID: "1", Name: "Team - one"})
+
+	var buf bytes.Buffer
+	require.NoError(t, yaml.NewEncoder(&buf).Encode(source.Export()))
+	assert.Contains(t, buf.String(), "strip_prefixes:")
+
+	var doc exportDocument
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &doc))
+
+	newConfig := func(rules *AliasRules) Config {
+		var c Config
+		require.NoError(t, c.Decode(strings.NewReader("")))
+		c.AliasRules = rules
+		return c
+	}
+
+	target := newConfig(nil)
+	require.NoError(t, target.Import(doc, keepConflicts))
+	assert.Equal(t, source.AliasRules.StripPrefixes, target.AliasRules.StripPrefixes)
+	assert.Equal(t, source.AliasRules.Rewrites, target.AliasRules.Rewrites)
+	assert.Equal(t, "one", target.Accounts.normalize(target.Accounts.accounts["1"]), "imported accounts should be normalized with the imported rules")
+
+	local := &AliasRules{StripPrefixes: []string{"AWS -"}}
+	keep := newConfig(local)
+	require.NoError(t, keep.Import(doc, keepConflicts))
+	assert.Same(t, local, keep.AliasRules)
+
+	overwrite := newConfig(local)
+	require.NoError(t, overwrite.Import(doc, overwriteConflicts))
+	assert.Equal(t, source.AliasRules.StripPrefixes, overwrite.AliasRules.StripPrefixes)
+}
+
+func TestImportConflictStrategies(t *testing.T) {
+	doc := exportDocument{
+		Version:  exportDocumentVersion,
+		Accounts: []exportedAccount{{ID: "1", Name: "one", Aliases: []string{"imported"}, Region: "eu-west-1"}},
+	}
+
+	newConfig := func() Config {
+		var c Config
+		c.AddAccount("1", Account{ID: "1", Name: "one", Aliases: []string{"local"}})
+		c.AddAccount("2", Account{ID: "2", Name: "two", Aliases: []string{"imported"}})
+		return c
+	}
+
+	keep := newConfig()
+	require.NoError(t, keep.Import(doc, keepConflicts))
+	assert.Equal(t, []string{"local"}, keep.Accounts.accounts["1"].Aliases)
+	assert.Equal(t, []string{"imported"}, keep.Accounts.accounts["2"].Aliases)
+	assert.Equal(t, "eu-west-1", keep.Accounts.accounts["1"].Region, "values that do not conflict should always be imported")
+
+	overwrite := newConfig()
+	require.NoError(t, overwrite.Import(doc, overwriteConflicts))
+	assert.Equal(t, []string{"local", "imported"}, overwrite.Accounts.accounts["1"].Aliases)
+	assert.Empty(t, overwrite.Accounts.accounts["2"].Aliases, "the alias should have been moved to the imported account")
+
+	var prompts bytes.Buffer
+	prompt := newConfig()
+	require.NoError(t, prompt.Import(doc, promptForConflicts(strings.NewReader("maybe\no\n"), &prompts)))
+	assert.Equal(t, []string{"local", "imported"}, prompt.Accounts.accounts["1"].Aliases)
+	assert.Equal(t, 2, strings.Count(prompts.String(), `1 alias imported: keep "2" or overwrite with "1"?`))
+
+	tooNew := newConfig()
+	assert.Error(t, tooNew.Import(exportDocument{Version: exportDocumentVersion + 1}, keepConflicts))
+}
+
+func TestAssertionChangeWarning(t *testing.T) {
+	var before Config
+	after := before
+	assert.Empty(t, assertionChangeWarning(&before, &after))
+
+	after.AssertionProvider, after.AssertionURL = assertionProviderHTTP, "https://idp.example.com/saml/{application}"
+	assert.Contains(t, assertionChangeWarning(&before, &after), "https://idp.example.com/saml/{application}")
+
+	before = after
+	assert.Empty(t, assertionChangeWarning(&before, &after), "importing the same assertion URL again is not a change")
+
+	after.AssertionURL = "https://elsewhere.example.com/saml"
+	assert.Contains(t, assertionChangeWarning(&before, &after), "https://elsewhere.example.com/saml")
+
+	after.AssertionProvider = assertionProviderOkta
+	assert.Empty(t, assertionChangeWarning(&before, &after), "the access token is only sent to the assertion URL by the http provider")
+}
+
+func TestAccountMarshalJSONWritesLegacyAlias(t *testing.T) {
+	buf, err := json.Marshal(Account{ID: "1", Name: "name", Aliases: []string{"first", "second"}})
+	require.NoError(t, err)
+
+	var legacy struct {
+		Alias string `json:"alias"`
+	}
+	require.NoError(t, json.Unmarshal(buf, &legacy))
+	assert.Equal(t, "first", legacy.Alias)
+
+	var acc Account
+	require.NoError(t, json.Unmarshal(buf, &acc))
+	assert.Equal(t, []string{"first", "second"}, acc.Aliases)
+}
+
+func TestAliasRejectsUnknownAccountsAndCollisions(t *testing.T) {
+	cfg := Config{}
+	cfg.AddAccount("1", Account{ID: "1", Name: "AWS - One", Aliases: []string{"one"}})
+	cfg.AddAccount("2", Account{ID: "2", Name: "AWS - Two"})
+
+	var collisionErr AliasCollisionError
+	assert.ErrorAs(t, cfg.Alias("2", "one"), &collisionErr, "aliases of other accounts cannot be reused")
+	assert.ErrorAs(t, cfg.Alias("2", "One"), &collisionErr, "names of other accounts cannot be used")
+	assert.ErrorAs(t, cfg.Alias("2", "1"), &collisionErr, "IDs of other accounts cannot be used")
+	assert.Equal(t, "1", collisionErr.Account.ID)
+	assert.Error(t, cfg.Alias("2", ""))
+	assert.Error(t, cfg.Alias("unknown-account", "alias"))
+
+	require.NoError(t, cfg.Alias("2", "two"))
+	require.NoError(t, cfg.Alias("2", "deux"))
+	require.NoError(t, cfg.Alias("2", "two"), "re-adding an existing alias is not an error")
+	assert.Equal(t, []string{"two", "deux"}, cfg.Accounts.accounts["2"].Aliases)
+
+	assert.Equal(t, []string{"deux"}, cfg.Unalias("deux"))
+	assert.Equal(t, []string{"two"}, cfg.Accounts.accounts["2"].Aliases)
+	assert.Equal(t, []string{"two"}, cfg.Unalias("AWS - Two"), "giving an account name removes all of its aliases")
+	assert.Empty(t, cfg.Unalias("AWS - Two"))
+}
@@ -0,0 +1,253 @@
+package command
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	outputTypeText             = "text"
+	permittedConfigOutputTypes = []string{outputTypeText, outputTypeJSON}
+)
+
+func init() {
+	configCmd.PersistentFlags().StringP(FlagOutputType, "o", outputTypeText, "Format to print settings in. Supported outputs: text, json")
+	configCmd.PersistentFlags().SetAnnotation(FlagOutputType, annotationNoEnvironment, []string{"true"})
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configEditCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "View and change settings.",
+	Long: fmt.Sprintf(`View and change settings stored in the configuration file.
+
+%s
+
+Supported settings: %s`, settingPrecedence, strings.Join(settingKeys(), ", ")),
+}
+
+func configOutputType(cmd *cobra.Command) (string, error) {
+	outputType, _ := cmd.Flags().GetString(FlagOutputType)
+	if !slices.Contains(permittedConfigOutputTypes, outputType) {
+		return "", ValueError{Value: outputType, ValidValues: permittedConfigOutputTypes}
+	}
+	return outputType, nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeSettingsTable(w io.Writer, values []resolvedSetting, withHeaders bool) error {
+	tbl := csv.NewWriter(w)
+	tbl.Comma = '\t'
+	if withHeaders {
+		tbl.Write([]string{"key", "value", "source"})
+	}
+
+	for _, v := range values {
+		tbl.Write([]string{v.Key, v.Value, string(v.Source)})
+	}
+
+	tbl.Flush()
+	return tbl.Error()
+}
+
+var configGetCmd = &cobra.Command{
+	Use:     "get <key>",
+	Short:   "Print the effective value of a setting.",
+	Args:    cobra.ExactArgs(1),
+	Example: "keyconjurer config get ttl",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputType, err := configOutputType(cmd)
+		if err != nil {
+			return err
+		}
+
+		s, err := findSetting(args[0])
+		if err != nil {
+			return err
+		}
+
+		r := resolveSetting(s, cmd.Flags(), ConfigFromCommand(cmd), ProjectConfigFromCommand(cmd))
+		if outputType == outputTypeJSON {
+			return writeJSON(cmd.OutOrStdout(), r)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), r.Value)
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:     "set <key> <value>",
+	Short:   "Store the value of a setting in the configuration file.",
+	Args:    cobra.ExactArgs(2),
+	Example: "keyconjurer config set ttl 4",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := findSetting(args[0])
+		if err != nil {
+			return err
+		}
+
+		if err := validateSettingValue(s, args[1]); err != nil {
+			return err
+		}
+
+		s.Set(ConfigFromCommand(cmd), args[1])
+		return nil
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:     "unset <key>",
+	Short:   "Remove a setting from the configuration file so that the default value is used.",
+	Args:    cobra.ExactArgs(1),
+	Example: "keyconjurer config unset ttl",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := findSetting(args[0])
+		if err != nil {
+			return err
+		}
+
+		s.Set(ConfigFromCommand(cmd), "")
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Print the effective value of every setting and where it came from.",
+	Long: fmt.Sprintf(`Print the effective value of every setting and where it came from.
+
+%s`, settingPrecedence),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		outputType, err := configOutputType(cmd)
+		if err != nil {
+			return err
+		}
+
+		config := ConfigFromCommand(cmd)
+		project := ProjectConfigFromCommand(cmd)
+		values := make([]resolvedSetting, len(settings))
+		for i, s := range settings {
+			values[i] = resolveSetting(s, cmd.Flags(), config, project)
+		}
+
+		if outputType == outputTypeJSON {
+			return writeJSON(cmd.OutOrStdout(), values)
+		}
+
+		return writeSettingsTable(cmd.OutOrStdout(), values, !ShouldUseMachineOutput(cmd.Flags()))
+	},
+}
+
+// findEditor returns the command line of the user's preferred text editor.
+func findEditor() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if v := strings.Fields(os.Getenv(env)); len(v) > 0 {
+			return v
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+
+	return []string{"vi"}
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open the configuration file in your text editor.",
+	Long: `Open the configuration file in the editor named by $VISUAL or $EDITOR.
+
+The file is only saved if it is valid after editing. If it is not, your changes are kept in a temporary file so that they are not lost.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		config := ConfigFromCommand(cmd)
+
+		// The user edits a copy of the config so that an invalid edit never replaces the real file.
+		f, err := os.CreateTemp("", "keyconjurer-config-*.json")
+		if err != nil {
+			return err
+		}
+
+		tmpPath := f.Name()
+		if err := config.Encode(f); err != nil {
+			f.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+		f.Close()
+
+		editor := findEditor()
+		// The command context is not used because its --timeout deadline would kill the editor while the user is still editing.
+		c := exec.Command(editor[0], append(editor[1:], tmpPath)...)
+		c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := c.Run(); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("run editor %s: %w", editor[0], err)
+		}
+
+		buf, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return err
+		}
+
+		var edited Config
+		err = edited.Decode(bytes.NewReader(buf))
+		if err == nil {
+			err = edited.Validate()
+		}
+
+		if err != nil {
+			return genericError{
+				Message:  fmt.Sprintf("the edited configuration is invalid and was not saved: %s\nYour changes have been kept in %s", err, tmpPath),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+
+		// Editing can take a long time, so another process may have changed the file in the meantime.
+		// The user edited a snapshot which does not include those changes, so rather than merging their edits with changes they have not seen, the edit is refused.
+		path, err := findConfigPath()
+		if err != nil {
+			return err
+		}
+
+		changed, err := configChangedSince(path, config.loaded)
+		if err != nil {
+			return err
+		}
+
+		if changed {
+			return genericError{
+				Message:  fmt.Sprintf("the configuration file was changed by another process while you were editing it, so your changes were not saved.\nYour changes have been kept in %s", tmpPath),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+
+		os.Remove(tmpPath)
+		// Keep track of what was originally read from disk so the edited config is saved when the command finishes.
+		edited.loaded = config.loaded
+		*config = edited
+		return nil
+	},
+}
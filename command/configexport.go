@@ -0,0 +1,409 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	FlagOnConflict = "on-conflict"
+
+	exportFormatJSON       = "json"
+	exportFormatYAML       = "yaml"
+	permittedExportFormats = []string{exportFormatJSON, exportFormatYAML}
+
+	conflictStrategyKeep        = "keep"
+	conflictStrategyOverwrite   = "overwrite"
+	conflictStrategyPrompt      = "prompt"
+	permittedConflictStrategies = []string{conflictStrategyKeep, conflictStrategyOverwrite, conflictStrategyPrompt}
+)
+
+// exportDocumentVersion is incremented whenever a field is added to or changed in exportDocument, so that older versions refuse documents containing settings they would otherwise silently drop.
+//
+// Version 2 added alias rules.
+const exportDocumentVersion = 2
+
+// exportDocument is a portable representation of the parts of the config that are worth keeping when moving to a new machine or sharing with a team.
+//
+// Field names are the same in JSON and YAML. Since YAML is a superset of JSON, documents in either format can be read with a YAML decoder.
+type exportDocument struct {
+	Version    int               `json:"version" yaml:"version"`
+	Tenant     exportTenant      `json:"tenant" yaml:"tenant"`
+	Accounts   []exportedAccount `json:"accounts" yaml:"accounts"`
+	AliasRules *AliasRules       `json:"alias_rules,omitempty" yaml:"alias_rules,omitempty"`
+}
+
+type exportTenant struct {
+	OIDCDomain        string `json:"oidc_domain,omitempty" yaml:"oidc_domain,omitempty"`
+	ClientID          string `json:"client_id,omitempty" yaml:"client_id,omitempty"`
+	ServerAddress     string `json:"server_address,omitempty" yaml:"server_address,omitempty"`
+	AssertionProvider string `json:"assertion_provider,omitempty" yaml:"assertion_provider,omitempty"`
+	AssertionURL      string `json:"assertion_url,omitempty" yaml:"assertion_url,omitempty"`
+}
+
+type exportedAccount struct {
+	ID          string   `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	Aliases     []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	DefaultRole string   `json:"default_role,omitempty" yaml:"default_role,omitempty"`
+	Region      string   `json:"region,omitempty" yaml:"region,omitempty"`
+	TTL         uint     `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	OutputType  string   `json:"output,omitempty" yaml:"output,omitempty"`
+	ShellType   string   `json:"shell,omitempty" yaml:"shell,omitempty"`
+	AWSProfile  string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Federation  string   `json:"federation,omitempty" yaml:"federation,omitempty"`
+	RoleARN     string   `json:"role_arn,omitempty" yaml:"role_arn,omitempty"`
+}
+
+// Export creates a portable document containing aliases, tags, per-account settings and tenant settings.
+func (c *Config) Export() exportDocument {
+	doc := exportDocument{
+		Version: exportDocumentVersion,
+		Tenant: exportTenant{
+			OIDCDomain:        c.OIDCDomain,
+			ClientID:          c.ClientID,
+			ServerAddress:     c.ServerAddress,
+			AssertionProvider: c.AssertionProvider,
+			AssertionURL:      c.AssertionURL,
+		},
+		Accounts:   []exportedAccount{},
+		AliasRules: c.AliasRules,
+	}
+
+	c.Accounts.ForEach(func(id string, acc Account, _ string) {
+		doc.Accounts = append(doc.Accounts, exportedAccount{
+			ID:          id,
+			Name:        acc.Name,
+			Aliases:     acc.Aliases,
+			Tags:        acc.Tags,
+			DefaultRole: acc.DefaultRole,
+			Region:      acc.Region,
+			TTL:         acc.TTL,
+			OutputType:  acc.OutputType,
+			ShellType:   acc.ShellType,
+			AWSProfile:  acc.AWSProfile,
+			Federation:  acc.Federation,
+			RoleARN:     acc.RoleARN,
+		})
+	})
+
+	return doc
+}
+
+// importConflict describes a value in an imported document which differs from a value already in the config.
+type importConflict struct {
+	// Subject is the ID of an account, "tenant", or "config" for alias rules.
+	Subject  string
+	Field    string
+	Current  string
+	Imported string
+}
+
+// conflictResolver decides whether the imported value should replace the current value.
+type conflictResolver func(importConflict) (overwrite bool, err error)
+
+type importMerger struct {
+	resolve conflictResolver
+	err     error
+}
+
+// merge copies imported into current if current is empty, or if they differ and the resolver allows it.
+func (m *importMerger) merge(subject, field string, current *string, imported string) {
+	if m.err != nil || imported == "" || *current == imported {
+		return
+	}
+
+	if *current == "" {
+		*current = imported
+		return
+	}
+
+	overwrite, err := m.resolve(importConflict{Subject: subject, Field: field, Current: *current, Imported: imported})
+	if err != nil {
+		m.err = err
+		return
+	}
+
+	if overwrite {
+		*current = imported
+	}
+}
+
+func (m *importMerger) mergeUint(subject, field string, current *uint, imported uint) {
+	var s string
+	if *current != 0 {
+		s = strconv.FormatUint(uint64(*current), 10)
+	}
+
+	var i string
+	if imported != 0 {
+		i = strconv.FormatUint(uint64(imported), 10)
+	}
+
+	m.merge(subject, field, &s, i)
+	*current = parseUint(s)
+}
+
+// mergeAlias adds an alias to an account. If another account already has the alias, the resolver decides which account keeps it.
+func (m *importMerger) mergeAlias(accounts *accountSet, id, alias string) {
+	if m.err != nil {
+		return
+	}
+
+	other, collides := accounts.aliasOwner(id, alias)
+	if collides && other.HasAlias(alias) {
+		current := other.ID
+		m.merge(id, "alias "+alias, &current, id)
+		if current == other.ID {
+			return
+		}
+
+		other.Aliases = slices.DeleteFunc(other.Aliases, func(a string) bool { return a == alias })
+	} else if collides {
+		// The alias is the ID or name of another account. There is no way to resolve this other than skipping the alias.
+		return
+	}
+
+	if m.err == nil {
+		m.err = accounts.Alias(id, alias)
+	}
+}
+
+// mergeAliasRules replaces the alias rules as a whole, since rules taken partly from each document are unlikely to produce the aliases either intended.
+func (m *importMerger) mergeAliasRules(rules **AliasRules, imported *AliasRules) {
+	if imported == nil {
+		return
+	}
+
+	var current string
+	if *rules != nil {
+		buf, _ := json.Marshal(*rules)
+		current = string(buf)
+	}
+
+	buf, _ := json.Marshal(imported)
+	m.merge("config", "alias_rules", &current, string(buf))
+	if current == string(buf) {
+		*rules = imported
+	}
+}
+
+func (m *importMerger) mergeTags(subject string, current *[]string, imported []string) {
+	s := strings.Join(*current, ",")
+	m.merge(subject, accountSettingTags, &s, strings.Join(imported, ","))
+	*current = splitTags(s)
+}
+
+// Import merges the given document into the config.
+//
+// Accounts that are not already in the config are added. When a value in the document differs from a value already present, resolve decides which is kept.
+func (c *Config) Import(doc exportDocument, resolve conflictResolver) error {
+	if doc.Version > exportDocumentVersion {
+		return fmt.Errorf("document version %d is newer than the newest version this version of KeyConjurer understands (%d)", doc.Version, exportDocumentVersion)
+	}
+
+	m := importMerger{resolve: resolve}
+	m.merge("tenant", FlagOIDCDomain, &c.OIDCDomain, doc.Tenant.OIDCDomain)
+	m.merge("tenant", FlagClientID, &c.ClientID, doc.Tenant.ClientID)
+	m.merge("tenant", FlagServerAddress, &c.ServerAddress, doc.Tenant.ServerAddress)
+	m.merge("tenant", FlagAssertionProvider, &c.AssertionProvider, doc.Tenant.AssertionProvider)
+	m.merge("tenant", FlagAssertionURL, &c.AssertionURL, doc.Tenant.AssertionURL)
+	// Alias rules are merged before accounts so that accounts added by the import are normalized with the imported rules.
+	m.mergeAliasRules(&c.AliasRules, doc.AliasRules)
+	if c.Accounts != nil {
+		c.Accounts.rules = c.AliasRules
+	}
+
+	for _, imported := range doc.Accounts {
+		if imported.ID == "" {
+			return fmt.Errorf("an account in the imported document has no id")
+		}
+
+		acc, ok := c.Accounts.accounts[imported.ID]
+		if !ok {
+			c.AddAccount(imported.ID, Account{ID: imported.ID, Name: imported.Name})
+			acc = c.Accounts.accounts[imported.ID]
+		}
+
+		m.merge(imported.ID, "name", &acc.Name, imported.Name)
+		for _, alias := range imported.Aliases {
+			m.mergeAlias(c.Accounts, imported.ID, alias)
+		}
+		m.mergeTags(imported.ID, &acc.Tags, imported.Tags)
+		m.merge(imported.ID, accountSettingRole, &acc.DefaultRole, imported.DefaultRole)
+		m.merge(imported.ID, accountSettingRegion, &acc.Region, imported.Region)
+		m.mergeUint(imported.ID, accountSettingTTL, &acc.TTL, imported.TTL)
+		m.merge(imported.ID, accountSettingOutputType, &acc.OutputType, imported.OutputType)
+		m.merge(imported.ID, accountSettingShellType, &acc.ShellType, imported.ShellType)
+		m.merge(imported.ID, accountSettingAWSProfile, &acc.AWSProfile, imported.AWSProfile)
+		m.merge(imported.ID, accountSettingFederation, &acc.Federation, imported.Federation)
+		m.merge(imported.ID, accountSettingRoleARN, &acc.RoleARN, imported.RoleARN)
+	}
+
+	if m.err != nil {
+		return m.err
+	}
+
+	return c.Validate()
+}
+
+// assertionChangeWarning returns a warning if importing settings changed where the access token of the user is sent to retrieve SAML assertions, or an empty string if it did not.
+func assertionChangeWarning(before, after *Config) string {
+	if after.AssertionProvider != assertionProviderHTTP {
+		return ""
+	}
+
+	if before.AssertionProvider == after.AssertionProvider && before.AssertionURL == after.AssertionURL {
+		return ""
+	}
+
+	return fmt.Sprintf("Warning: the imported settings send your access token to %s to retrieve SAML assertions. Only import settings from a source you trust, and run 'keyconjurer config unset %s' if you did not expect this.", after.AssertionURL, FlagAssertionProvider)
+}
+
+func keepConflicts(importConflict) (bool, error)      { return false, nil }
+func overwriteConflicts(importConflict) (bool, error) { return true, nil }
+
+// promptForConflicts asks the user how each conflict should be resolved.
+func promptForConflicts(in io.Reader, out io.Writer) conflictResolver {
+	scanner := bufio.NewScanner(in)
+	return func(c importConflict) (bool, error) {
+		for {
+			fmt.Fprintf(out, "%s %s: keep %q or overwrite with %q? [k/o] ", c.Subject, c.Field, c.Current, c.Imported)
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return false, err
+				}
+				return false, fmt.Errorf("no answer given for %s %s", c.Subject, c.Field)
+			}
+
+			switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+			case "k", "keep":
+				return false, nil
+			case "o", "overwrite":
+				return true, nil
+			}
+		}
+	}
+}
+
+func init() {
+	configImportCmd.Flags().String(FlagOnConflict, conflictStrategyPrompt, "How to handle values that differ from your existing settings. Supported strategies: keep, overwrite, prompt")
+	configCmd.AddCommand(configExportCmd)
+	configCmd.AddCommand(configImportCmd)
+}
+
+var configExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print aliases, account settings and tenant settings in a portable format.",
+	Long: `Print aliases, tags, per-account settings, alias rules and tenant settings in a portable format.
+
+Settings are printed as JSON, or as YAML with --output yaml. The output can be loaded on another machine, or shared with your team, using the config import command.`,
+	Example: "keyconjurer config export --output yaml > keyconjurer-export.yaml",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, _ := cmd.Flags().GetString(FlagOutputType)
+		if format == outputTypeText {
+			// text is the default of --output for the other config commands, and has no meaning for a document which is meant to be read back in.
+			format = exportFormatJSON
+		}
+
+		doc := ConfigFromCommand(cmd).Export()
+		switch format {
+		case exportFormatJSON:
+			return writeJSON(cmd.OutOrStdout(), doc)
+		case exportFormatYAML:
+			enc := yaml.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent(2)
+			if err := enc.Encode(doc); err != nil {
+				return err
+			}
+			return enc.Close()
+		default:
+			return ValueError{Value: format, ValidValues: permittedExportFormats}
+		}
+	},
+}
+
+var configImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Merge settings previously created with config export.",
+	Long: `Merge aliases, tags, per-account settings, alias rules and tenant settings from a file created by the config export command. Both JSON and YAML files are accepted. Use - to read from standard input.
+
+Accounts that you do not already have are added to your account cache. Values that differ from your existing settings are handled according to --on-conflict.`,
+	Example: "keyconjurer config import --on-conflict keep keyconjurer-export.yaml",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		strategy, _ := cmd.Flags().GetString(FlagOnConflict)
+		if !slices.Contains(permittedConflictStrategies, strategy) {
+			return ValueError{Value: strategy, ValidValues: permittedConflictStrategies}
+		}
+
+		var (
+			buf []byte
+			err error
+		)
+		if args[0] == "-" {
+			buf, err = io.ReadAll(cmd.InOrStdin())
+		} else {
+			buf, err = os.ReadFile(filepath.Clean(args[0]))
+		}
+		if err != nil {
+			return err
+		}
+
+		var doc exportDocument
+		if err := yaml.Unmarshal(buf, &doc); err != nil {
+			return genericError{
+				Message:  fmt.Sprintf("could not parse %s: %s", args[0], err),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+
+		resolve := keepConflicts
+		switch strategy {
+		case conflictStrategyOverwrite:
+			resolve = overwriteConflicts
+		case conflictStrategyPrompt:
+			if args[0] == "-" {
+				return fmt.Errorf("--%s=%s cannot be used when reading from standard input", FlagOnConflict, conflictStrategyPrompt)
+			}
+			resolve = promptForConflicts(cmd.InOrStdin(), cmd.ErrOrStderr())
+		}
+
+		// Work on a copy so that a failed import leaves the config untouched.
+		config := ConfigFromCommand(cmd)
+		var copied bytes.Buffer
+		if err := config.Encode(&copied); err != nil {
+			return err
+		}
+
+		var merged Config
+		if err := merged.Decode(&copied); err != nil {
+			return err
+		}
+
+		if err := merged.Import(doc, resolve); err != nil {
+			return err
+		}
+
+		if warning := assertionChangeWarning(config, &merged); warning != "" {
+			cmd.PrintErrln(warning)
+		}
+
+		merged.loaded = config.loaded
+		*config = merged
+		return nil
+	},
+}
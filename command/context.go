@@ -15,3 +15,30 @@ func ConfigFromCommand(cmd *cobra.Command) *Config {
 func ConfigContext(ctx context.Context, config *Config) context.Context {
 	return context.WithValue(ctx, ctxKeyConfig{}, config)
 }
+
+type ctxKeyProjectConfig struct{}
+
+// ProjectConfigFromCommand returns the project config for the current command, or nil if there is none.
+func ProjectConfigFromCommand(cmd *cobra.Command) *ProjectConfig {
+	p, _ := cmd.Context().Value(ctxKeyProjectConfig{}).(*ProjectConfig)
+	return p
+}
+
+func ProjectConfigContext(ctx context.Context, project *ProjectConfig) context.Context {
+	return context.WithValue(ctx, ctxKeyProjectConfig{}, project)
+}
+
+type ctxKeyCancel struct{}
+
+// cancelFromCommand returns the function which cancels the timeout of the current command.
+func cancelFromCommand(cmd *cobra.Command) context.CancelFunc {
+	cancel, ok := cmd.Context().Value(ctxKeyCancel{}).(context.CancelFunc)
+	if !ok {
+		return func() {}
+	}
+	return cancel
+}
+
+func cancelContext(ctx context.Context, cancel context.CancelFunc) context.Context {
+	return context.WithValue(ctx, ctxKeyCancel{}, cancel)
+}
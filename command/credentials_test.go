@@ -21,9 +21,9 @@ func setEnv(t *testing.T, valid bool) *Account {
 	}
 
 	return &Account{
-		ID:    "1234",
-		Name:  "account",
-		Alias: "account",
+		ID:      "1234",
+		Name:    "account",
+		Aliases: []string{"account"},
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/aws/smithy-go"
+	"github.com/riotgames/key-conjurer/internal/oktawebsso"
 )
 
 const (
@@ -16,6 +17,9 @@ const (
 	ExitCodeConnectivityError     int = 0x4
 	ExitCodeValueError            int = 0x5
 	ExitCodeAWSError              int = 0x6
+	ExitCodeStepUpRequired        int = 0x8
+	ExitCodeAccessDenied          int = 0x9
+	ExitCodeRateLimited           int = 0xA
 	ExitCodeUnknownError          int = 0x7D
 )
 
@@ -67,13 +71,51 @@ func UnknownRoleError(role, applicationID string) error {
 	}
 }
 
-func UnknownAccountError(accountID, bypassCacheFlag string) error {
+func UnknownAccountError(accountID, bypassCacheFlag string, suggestions ...string) error {
+	msg := fmt.Sprintf("%q is not a known account name in your account cache.", accountID)
+	if len(suggestions) > 0 {
+		msg += fmt.Sprintf(" Did you mean %s?", strings.Join(suggestions, ", "))
+	}
+
 	return genericError{
-		Message:  fmt.Sprintf("%q is not a known account name in your account cache. Your cache can be refreshed by entering executing `keyconjurer accounts`. If the value provided is an Okta application ID, you may provide --%s as an option to this command and try again.", accountID, bypassCacheFlag),
+		Message:  msg + fmt.Sprintf(" Your cache can be refreshed by entering executing `keyconjurer accounts`. If the value provided is an Okta application ID, you may provide --%s as an option to this command and try again.", bypassCacheFlag),
 		ExitCode: ExitCodeValueError,
 	}
 }
 
+// AmbiguousAccountError indicates that the name given by the user matches more than one account.
+type AmbiguousAccountError struct {
+	Name       string
+	Candidates []*Account
+}
+
+func (e AmbiguousAccountError) Error() string {
+	var candidates []string
+	for _, acc := range e.Candidates {
+		candidates = append(candidates, fmt.Sprintf("  %s\t%s", acc.ID, acc.displayName()))
+	}
+
+	return fmt.Sprintf("%q matches more than one account. Use the account ID or a more specific name instead:\n%s", e.Name, strings.Join(candidates, "\n"))
+}
+
+func (e AmbiguousAccountError) Code() int {
+	return ExitCodeValueError
+}
+
+// AliasCollisionError indicates that an alias could be confused with a different account.
+type AliasCollisionError struct {
+	Alias   string
+	Account *Account
+}
+
+func (e AliasCollisionError) Error() string {
+	return fmt.Sprintf("%q cannot be used as an alias because it would be confused with account %s (%s)", e.Alias, e.Account.ID, e.Account.Name)
+}
+
+func (e AliasCollisionError) Code() int {
+	return ExitCodeValueError
+}
+
 type ValueError struct {
 	Value       string
 	ValidValues []string
@@ -110,6 +152,38 @@ func (o OktaError) Code() int {
 	return ExitCodeUndisclosedOktaError
 }
 
+// webSSOError converts an error describing a page Okta served in place of a SAML assertion into an error telling the user what to do about it.
+//
+// Other errors are returned unchanged.
+func webSSOError(err error, applicationID string) error {
+	var pageErr *oktawebsso.PageError
+	if !errors.As(err, &pageErr) {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, oktawebsso.ErrSessionExpired):
+		return ErrTokensExpiredOrAbsent
+	case errors.Is(err, oktawebsso.ErrStepUpRequired):
+		return genericError{
+			Message:  fmt.Sprintf("Okta requires you to verify your identity again before you can access application %s. Run `keyconjurer login` and try again.", applicationID),
+			ExitCode: ExitCodeStepUpRequired,
+		}
+	case errors.Is(err, oktawebsso.ErrAccessDenied):
+		return genericError{
+			Message:  fmt.Sprintf("Okta denied access to application %s. It may not be assigned to you; contact your administrator if you believe you should have access.", applicationID),
+			ExitCode: ExitCodeAccessDenied,
+		}
+	case errors.Is(err, oktawebsso.ErrRateLimited):
+		return genericError{
+			Message:  "Okta is limiting the rate of requests. Wait a minute and try again.",
+			ExitCode: ExitCodeRateLimited,
+		}
+	default:
+		return OktaError{InnerError: err, Message: fmt.Sprintf("Okta did not return a SAML assertion for application %s: %s", applicationID, pageErr)}
+	}
+}
+
 type AWSError struct {
 	InnerError error
 	Message    string
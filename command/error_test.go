@@ -1,10 +1,14 @@
 package command
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/aws/smithy-go"
+	"github.com/riotgames/key-conjurer/internal/oktawebsso"
 	"github.com/stretchr/testify/require"
 )
 
@@ -43,3 +47,31 @@ func Test_tryParseTimeToLiveError(t *testing.T) {
 		require.Equal(t, ttlError.Code(), ExitCodeValueError)
 	})
 }
+
+func Test_webSSOError(t *testing.T) {
+	tests := []struct {
+		reason error
+		code   int
+	}{
+		{reason: oktawebsso.ErrSessionExpired, code: ExitCodeTokensExpiredOrAbsent},
+		{reason: oktawebsso.ErrStepUpRequired, code: ExitCodeStepUpRequired},
+		{reason: oktawebsso.ErrAccessDenied, code: ExitCodeAccessDenied},
+		{reason: oktawebsso.ErrRateLimited, code: ExitCodeRateLimited},
+		{reason: oktawebsso.ErrNoSAMLAssertion, code: ExitCodeUndisclosedOktaError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reason.Error(), func(t *testing.T) {
+			// The assertion provider wraps the page error, so it must still be recognised.
+			err := fmt.Errorf("get saml assertion: %w", &oktawebsso.PageError{Reason: tt.reason, StatusCode: http.StatusOK})
+			code, ok := GetExitCode(webSSOError(err, "0oa1"))
+			require.True(t, ok)
+			require.Equal(t, tt.code, code)
+		})
+	}
+
+	require.ErrorIs(t, webSSOError(&oktawebsso.PageError{Reason: oktawebsso.ErrSessionExpired}, "0oa1"), ErrTokensExpiredOrAbsent, "an expired session should be retried after logging in with --login")
+
+	other := errors.New("connection refused")
+	require.Equal(t, other, webSSOError(other, "0oa1"))
+}
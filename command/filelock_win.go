@@ -0,0 +1,27 @@
+//go:build windows
+
+package command
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// allBytes is passed to LockFileEx and UnlockFileEx to lock the entire file regardless of its size.
+const allBytes = ^uint32(0)
+
+func lockFile(f *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	ol := new(windows.Overlapped)
+	return windows.LockFileEx(windows.Handle(f.Fd()), flags, 0, allBytes, allBytes, ol)
+}
+
+func unlockFile(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, allBytes, allBytes, ol)
+}
@@ -5,14 +5,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
 	"os"
 	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/riotgames/key-conjurer/pkg/oauth2cli"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -22,6 +25,7 @@ var (
 	FlagTimeToLive    = "ttl"
 	FlagBypassCache   = "bypass-cache"
 	FlagLogin         = "login"
+	FlagAWSProfile    = "profile"
 )
 
 var (
@@ -45,15 +49,18 @@ func init() {
 	getCmd.Flags().Bool(FlagBypassCache, false, "Do not check the cache for accounts and send the application ID as-is to Okta. This is useful if you have an ID you know is an Okta application ID and it is not stored in your local account cache.")
 	getCmd.Flags().Bool(FlagLogin, false, "Login to Okta before running the command")
 	getCmd.Flags().String(FlagAWSCLIPath, "~/.aws/", "Path for directory used by the aws CLI")
+	getCmd.Flags().String(FlagAWSProfile, "", "If output type is awscli, the name of the profile to save credentials to. Defaults to the account name or alias given.")
 	getCmd.Flags().BoolP(FlagURLOnly, "u", false, "Print only the URL to visit rather than a user-friendly message")
 	getCmd.Flags().BoolP(FlagNoBrowser, "b", false, "Do not open a browser window, printing the URL instead")
+	getCmd.Flags().String(FlagServerAddress, ServerAddress, "The address of the account server. This does not usually need to be changed or specified.")
+	getCmd.Flags().Uint(FlagAccountsMaxAge, DefaultAccountsMaxAge, "Refresh the account list after writing credentials if it is older than this many hours.")
 }
 
-func resolveApplicationInfo(cfg *Config, bypassCache bool, nameOrID string) (*Account, bool) {
+func resolveApplicationInfo(cfg *Config, bypassCache bool, nameOrID string) (*Account, error) {
 	if bypassCache {
-		return &Account{ID: nameOrID, Name: nameOrID}, true
+		return &Account{ID: nameOrID, Name: nameOrID}, nil
 	}
-	return cfg.FindAccount(nameOrID)
+	return cfg.ResolveAccount(nameOrID)
 }
 
 type GetCommand struct {
@@ -61,8 +68,16 @@ type GetCommand struct {
 	TimeToLive                                                                uint
 	TimeRemaining                                                             uint
 	OutputType, ShellType, RoleName, AWSCLIPath, OIDCDomain, ClientID, Region string
+	AWSProfile, ServerAddress, RoleSessionName                                string
+	AccountsMaxAge                                                            uint
+	Assertion                                                                 assertionSettings
 	Login, URLOnly, NoBrowser, BypassCache, MachineOutput                     bool
 
+	// Interactive indicates that the user may be asked to choose a role through Stdin if one was not given.
+	Interactive bool
+	Stdin       io.Reader
+	Stderr      io.Writer
+
 	UsageFunc  func() error
 	PrintErrln func(...any)
 }
@@ -82,16 +97,86 @@ func (g *GetCommand) Parse(cmd *cobra.Command, args []string) error {
 	g.NoBrowser, _ = flags.GetBool(FlagNoBrowser)
 	g.BypassCache, _ = flags.GetBool(FlagBypassCache)
 	g.Region, _ = flags.GetString(FlagRegion)
+	g.AWSProfile, _ = flags.GetString(FlagAWSProfile)
+	g.RoleSessionName, _ = flags.GetString(FlagRoleSessionName)
+	g.ServerAddress, _ = flags.GetString(FlagServerAddress)
+	g.AccountsMaxAge, _ = flags.GetUint(FlagAccountsMaxAge)
+	g.Assertion = assertionSettingsFromFlags(flags)
 	g.UsageFunc = cmd.Usage
 	g.PrintErrln = cmd.PrintErrln
+	g.Stdin = cmd.InOrStdin()
+	g.Stderr = cmd.ErrOrStderr()
 	g.MachineOutput = ShouldUseMachineOutput(flags) || g.URLOnly
-	if len(args) == 0 {
+	g.Interactive = !g.MachineOutput && isTerminal(os.Stdin)
+	if len(args) > 0 {
+		g.AccountIDOrName = args[0]
+	} else if project := ProjectConfigFromCommand(cmd); project != nil && project.Account != "" {
+		g.AccountIDOrName = project.Account
+	} else {
 		return fmt.Errorf("account name or alias is required")
 	}
-	g.AccountIDOrName = args[0]
+	g.applyDefaults(flags, ConfigFromCommand(cmd), ProjectConfigFromCommand(cmd))
 	return nil
 }
 
+// applyDefaults fills in values for flags that were not explicitly given using the settings for the account, falling back to the global settings in the config.
+//
+// The role, region and TTL pinned by a project config are only used for the project's account; for any other account they are treated as if they were not given.
+func (g *GetCommand) applyDefaults(flags *pflag.FlagSet, config *Config, project *ProjectConfig) {
+	account, err := resolveApplicationInfo(config, g.BypassCache, g.AccountIDOrName)
+	if err != nil {
+		// Execute reports the error; here we only need to know there are no account settings to apply.
+		account = &Account{}
+	}
+
+	projectApplies := project.AppliesTo(config, g.AccountIDOrName)
+	if !projectApplies {
+		if flagFromProject(flags, FlagRoleName) {
+			g.RoleName = flags.Lookup(FlagRoleName).DefValue
+		}
+
+		if flagFromProject(flags, FlagRegion) {
+			g.Region = flags.Lookup(FlagRegion).DefValue
+		}
+
+		if flagFromProject(flags, FlagTimeToLive) {
+			g.TimeToLive = parseUint(flags.Lookup(FlagTimeToLive).DefValue)
+		}
+	}
+
+	given := func(name string) bool {
+		return flags.Changed(name) && (projectApplies || !flagFromProject(flags, name))
+	}
+
+	if !given(FlagRoleName) && account.DefaultRole != "" {
+		g.RoleName = account.DefaultRole
+	}
+
+	if !given(FlagRegion) && account.Region != "" {
+		g.Region = account.Region
+	}
+
+	if !given(FlagTimeToLive) {
+		if account.TTL != 0 {
+			g.TimeToLive = account.TTL
+		} else if config.TTL != 0 {
+			g.TimeToLive = config.TTL
+		}
+	}
+
+	if !flags.Changed(FlagOutputType) && account.OutputType != "" {
+		g.OutputType = account.OutputType
+	}
+
+	if !flags.Changed(FlagShellType) && account.ShellType != "" {
+		g.ShellType = account.ShellType
+	}
+
+	if !flags.Changed(FlagAWSProfile) && account.AWSProfile != "" {
+		g.AWSProfile = account.AWSProfile
+	}
+}
+
 func (g GetCommand) Validate() error {
 	if !slices.Contains(permittedOutputTypes, g.OutputType) {
 		return ValueError{Value: g.OutputType, ValidValues: permittedOutputTypes}
@@ -118,26 +203,46 @@ func (g GetCommand) Execute(ctx context.Context, config *Config) error {
 		return g.printUsage()
 	}
 
-	account, ok := resolveApplicationInfo(config, g.BypassCache, accountID)
-	if !ok {
-		return UnknownAccountError(g.AccountIDOrName, FlagBypassCache)
+	account, err := resolveApplicationInfo(config, g.BypassCache, accountID)
+	if err != nil {
+		return err
 	}
 
-	if g.RoleName == "" {
-		if account.MostRecentRole == "" {
-			g.PrintErrln("You must specify the --role flag with this command")
-			return nil
+	if account.Federation == federationOIDC {
+		// The role is given by a role ARN rather than chosen from the roles in a SAML assertion.
+		if _, err := g.webIdentityRoleARN(*account); err != nil {
+			return err
 		}
+	} else if g.RoleName == "" {
 		g.RoleName = account.MostRecentRole
 	}
 
+	if g.RoleName == "" && g.Interactive && account.Federation != federationOIDC {
+		if roles, err := fetchRolesFromServer(ctx, g.ServerAddress, &keychainTokenSource{}, account.ID); err == nil {
+			if g.RoleName, err = pickRole(g.Stdin, g.Stderr, roles); err != nil {
+				return err
+			}
+		}
+	}
+
+	if g.RoleName == "" && account.Federation != federationOIDC {
+		g.PrintErrln("You must specify the --role flag with this command")
+		return nil
+	}
+
 	if config.TimeRemaining != 0 && g.TimeRemaining == DefaultTimeRemaining {
 		g.TimeRemaining = config.TimeRemaining
 	}
 
+	// The account refresh runs while credentials are fetched so that get rarely has to wait for it.
+	var refresh <-chan accountRefreshResult
+	if serverAddr, err := url.Parse(g.ServerAddress); err == nil && serverAddr.Host != "" && !g.BypassCache && config.AccountsRefreshDue(time.Now(), g.AccountsMaxAge) {
+		refresh = startAccountRefresh(ctx, serverAddr, config.AliasRules)
+	}
+
 	credentials := LoadAWSCredentialsFromEnvironment()
 	if !credentials.ValidUntil(account, time.Duration(g.TimeRemaining)*time.Minute) {
-		newCredentials, err := g.fetchNewCredentials(ctx, *account, config)
+		newCredentials, err := g.fetchNewCredentials(ctx, *account)
 		if errors.Is(err, ErrTokensExpiredOrAbsent) && g.Login {
 			loginCommand := LoginCommand{
 				OIDCDomain:    g.OIDCDomain,
@@ -149,7 +254,7 @@ func (g GetCommand) Execute(ctx context.Context, config *Config) error {
 			if err != nil {
 				return err
 			}
-			newCredentials, err = g.fetchNewCredentials(ctx, *account, config)
+			newCredentials, err = g.fetchNewCredentials(ctx, *account)
 		}
 
 		if err != nil {
@@ -159,16 +264,70 @@ func (g GetCommand) Execute(ctx context.Context, config *Config) error {
 		credentials = *newCredentials
 	}
 
-	if account != nil {
+	// Accounts which use OIDC federation are given roles by ARN rather than by name, so they have no role name to remember.
+	if account != nil && account.Federation != federationOIDC {
 		account.MostRecentRole = g.RoleName
 	}
 
 	config.LastUsedAccount = &accountID
-	return echoCredentials(accountID, accountID, credentials, g.OutputType, g.ShellType, g.AWSCLIPath)
+	profileName := accountID
+	if g.AWSProfile != "" {
+		profileName = g.AWSProfile
+	}
+
+	err = echoCredentials(accountID, profileName, credentials, g.OutputType, g.ShellType, g.AWSCLIPath)
+	if refresh != nil {
+		g.finishAccountRefresh(config, refresh, accountRefreshWaitTimeout)
+	}
+	return err
 }
 
-func (g GetCommand) fetchNewCredentials(ctx context.Context, account Account, cfg *Config) (*CloudCredentials, error) {
-	samlResponse, assertionStr, err := oauth2cli.DiscoverConfigAndExchangeTokenForAssertion(ctx, &keychainTokenSource{}, g.OIDCDomain, g.ClientID, account.ID)
+// finishAccountRefresh waits up to timeout for an automatic account refresh to complete and updates the account cache with the result, printing the changes.
+//
+// Failing to refresh is not an error because the credentials have already been written; the cached accounts continue to be used.
+// Refreshes which fail are recorded so that they are not retried by every invocation of get. Refreshes which are abandoned because they took too long are not, since they did not fail.
+func (g GetCommand) finishAccountRefresh(config *Config, refresh <-chan accountRefreshResult, timeout time.Duration) {
+	var result accountRefreshResult
+	select {
+	case result = <-refresh:
+	case <-time.After(timeout):
+		slog.Debug("gave up waiting for account refresh", slog.Duration("timeout", timeout))
+		return
+	}
+
+	if errors.Is(result.Err, ErrTokensExpiredOrAbsent) {
+		// The refresh can be retried as soon as the user has logged in again.
+		return
+	}
+
+	now := time.Now().UTC()
+	if result.Err != nil {
+		config.AccountsRefreshAttemptedAt = &now
+		if !g.MachineOutput {
+			g.PrintErrln(fmt.Sprintf("Could not refresh accounts (%s) - using cached accounts %s.", result.Err, config.describeAccountsAge(now)))
+		}
+		return
+	}
+
+	refreshedBefore := config.AccountsRefreshedAt != nil
+	diff := config.UpdateAccounts(result.Accounts)
+	if !g.MachineOutput && refreshedBefore && !diff.Empty() {
+		g.PrintErrln("Changes since the last refresh:")
+		diff.Write(g.Stderr)
+	}
+}
+
+func (g GetCommand) fetchNewCredentials(ctx context.Context, account Account) (*CloudCredentials, error) {
+	if account.Federation == federationOIDC {
+		return g.fetchWebIdentityCredentials(ctx, account)
+	}
+
+	provider, err := g.Assertion.AssertionProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	samlResponse, assertionStr, err := exchangeTokenForAssertion(ctx, provider, account.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -178,10 +337,6 @@ func (g GetCommand) fetchNewCredentials(ctx context.Context, account Account, cf
 		return nil, UnknownRoleError(g.RoleName, g.AccountIDOrName)
 	}
 
-	if g.TimeToLive == 1 && cfg.TTL != 0 {
-		g.TimeToLive = cfg.TTL
-	}
-
 	stsClient := sts.New(sts.Options{Region: g.Region})
 	timeoutInSeconds := int32(3600 * g.TimeToLive)
 	resp, err := stsClient.AssumeRoleWithSAML(ctx, &sts.AssumeRoleWithSAMLInput{
@@ -212,11 +367,13 @@ func (g GetCommand) fetchNewCredentials(ctx context.Context, account Account, cf
 }
 
 var getCmd = &cobra.Command{
-	Use:   "get <accountName/alias>",
+	Use:   "get [accountName/alias]",
 	Short: "Retrieves temporary cloud API credentials.",
 	Long: `Retrieves temporary cloud API credentials for the specified account.  It sends a push request to the first Duo device it finds associated with your account.
 
-A role must be specified when using this command through the --role flag. You may list the roles you can assume through the roles command.`,
+A role must be specified when using this command through the --role flag, unless a default role has been set for the account using the set account command. You may list the roles you can assume through the roles command.
+
+If no account is given, the account named in the nearest ` + ProjectConfigFileName + ` file is used.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var getCmd GetCommand
 		if err := getCmd.Parse(cmd, args); err != nil {
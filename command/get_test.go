@@ -0,0 +1,101 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCommandApplyDefaults(t *testing.T) {
+	config := Config{TTL: 2}
+	config.AddAccount("1", Account{ID: "1", Name: "test", DefaultRole: "Admin", Region: "eu-west-1", TTL: 4, AWSProfile: "prod"})
+	config.AddAccount("2", Account{ID: "2", Name: "other"})
+
+	t.Run("UsesAccountSettings", func(t *testing.T) {
+		flags := getCmd.Flags()
+		var g GetCommand
+		g.AccountIDOrName = "test"
+		g.Region, _ = flags.GetString(FlagRegion)
+		g.applyDefaults(flags, &config, nil)
+
+		assert.Equal(t, "Admin", g.RoleName)
+		assert.Equal(t, "eu-west-1", g.Region)
+		assert.Equal(t, uint(4), g.TimeToLive)
+		assert.Equal(t, "prod", g.AWSProfile)
+	})
+
+	t.Run("FallsBackToGlobalTTL", func(t *testing.T) {
+		var g GetCommand
+		g.AccountIDOrName = "other"
+		g.applyDefaults(getCmd.Flags(), &config, nil)
+
+		assert.Equal(t, "", g.RoleName)
+		assert.Equal(t, uint(2), g.TimeToLive)
+	})
+
+	t.Run("ExplicitFlagsWin", func(t *testing.T) {
+		flags := getCmd.Flags()
+		require.NoError(t, flags.Set(FlagRoleName, "ReadOnly"))
+		require.NoError(t, flags.Set(FlagTimeToLive, "1"))
+		t.Cleanup(func() {
+			flags.Set(FlagRoleName, "")
+			flags.Set(FlagTimeToLive, "1")
+			flags.Lookup(FlagRoleName).Changed = false
+			flags.Lookup(FlagTimeToLive).Changed = false
+		})
+
+		g := GetCommand{AccountIDOrName: "test", RoleName: "ReadOnly", TimeToLive: 1}
+		g.applyDefaults(flags, &config, nil)
+
+		assert.Equal(t, "ReadOnly", g.RoleName)
+		assert.Equal(t, uint(1), g.TimeToLive)
+	})
+}
+
+func TestGetCommandApplyDefaultsProjectConfig(t *testing.T) {
+	config := Config{}
+	config.AddAccount("1", Account{ID: "1", Name: "project", Aliases: []string{"project"}})
+	config.AddAccount("2", Account{ID: "2", Name: "other", Aliases: []string{"other"}, DefaultRole: "OtherRole"})
+	project := &ProjectConfig{Account: "project", Role: "ProjectRole", Region: "eu-west-1", TTL: 2}
+
+	// newFlags returns the flags after the command line has been parsed and the project config applied.
+	newFlags := func(t *testing.T, args ...string) *pflag.FlagSet {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.String(FlagRoleName, "", "")
+		flags.String(FlagRegion, "us-west-2", "")
+		flags.Uint(FlagTimeToLive, 1, "")
+		require.NoError(t, flags.Parse(args))
+		require.NoError(t, applyProjectConfigToFlags(flags, project))
+		return flags
+	}
+
+	parse := func(flags *pflag.FlagSet, account string) GetCommand {
+		g := GetCommand{AccountIDOrName: account}
+		g.RoleName, _ = flags.GetString(FlagRoleName)
+		g.Region, _ = flags.GetString(FlagRegion)
+		g.TimeToLive, _ = flags.GetUint(FlagTimeToLive)
+		g.applyDefaults(flags, &config, project)
+		return g
+	}
+
+	t.Run("ProjectAccount", func(t *testing.T) {
+		g := parse(newFlags(t), "1")
+		assert.Equal(t, "ProjectRole", g.RoleName)
+		assert.Equal(t, "eu-west-1", g.Region)
+		assert.Equal(t, uint(2), g.TimeToLive)
+	})
+
+	t.Run("DifferentAccount", func(t *testing.T) {
+		g := parse(newFlags(t), "other")
+		assert.Equal(t, "OtherRole", g.RoleName, "the account's own default role should be used")
+		assert.Equal(t, "us-west-2", g.Region)
+		assert.Equal(t, uint(1), g.TimeToLive)
+	})
+
+	t.Run("DifferentAccountWithExplicitFlag", func(t *testing.T) {
+		g := parse(newFlags(t, "--region", "ap-southeast-2"), "other")
+		assert.Equal(t, "ap-southeast-2", g.Region)
+	})
+}
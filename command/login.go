@@ -53,9 +53,13 @@ var loginCmd = &cobra.Command{
 // What this means is implementation specific, but this usually indicates the user is trying to use this program in a script and we should avoid user-friendly output messages associated with values a user might find useful.
 func ShouldUseMachineOutput(flags *pflag.FlagSet) bool {
 	quiet, _ := flags.GetBool(FlagQuiet)
-	fi, _ := os.Stdout.Stat()
-	isPiped := fi.Mode()&os.ModeCharDevice == 0
-	return isPiped || quiet
+	return !isTerminal(os.Stdout) || quiet
+}
+
+// isTerminal indicates whether f is connected to a terminal rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
 type LoginCommand struct {
@@ -0,0 +1,107 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigFileName is the name of the project configuration file KeyConjurer looks for in the working directory and its parents.
+const ProjectConfigFileName = ".keyconjurer.yaml"
+
+// ProjectConfig is a configuration file that can be checked in to a repository to pin the account, role, region and TTL used by commands run within it.
+type ProjectConfig struct {
+	Account string `yaml:"account"`
+	Role    string `yaml:"role"`
+	Region  string `yaml:"region"`
+	TTL     uint   `yaml:"ttl"`
+
+	// Path is the location of the file this config was read from.
+	Path string `yaml:"-"`
+}
+
+// FlagValues returns the values in the project config keyed by the name of the flag they correspond to.
+func (p *ProjectConfig) FlagValues() map[string]string {
+	values := make(map[string]string)
+	if p == nil {
+		return values
+	}
+
+	if p.Role != "" {
+		values[FlagRoleName] = p.Role
+	}
+
+	if p.Region != "" {
+		values[FlagRegion] = p.Region
+	}
+
+	if p.TTL != 0 {
+		values[FlagTimeToLive] = strconv.FormatUint(uint64(p.TTL), 10)
+	}
+
+	return values
+}
+
+// AppliesTo reports whether the values pinned by the project config should be used for the account given by nameOrID.
+//
+// They apply to every account if the project config does not name one.
+func (p *ProjectConfig) AppliesTo(config *Config, nameOrID string) bool {
+	if p == nil || p.Account == "" || p.Account == nameOrID {
+		return true
+	}
+
+	got, err := config.ResolveAccount(nameOrID)
+	if err != nil {
+		return false
+	}
+
+	pinned, err := config.ResolveAccount(p.Account)
+	return err == nil && pinned.ID == got.ID
+}
+
+// findProjectConfig looks for a project config file in dir and each of its parents, returning the first one found.
+//
+// nil is returned if no project config file exists.
+func findProjectConfig(dir string) (*ProjectConfig, error) {
+	for {
+		path := filepath.Join(dir, ProjectConfigFileName)
+		buf, err := os.ReadFile(path)
+		if err == nil {
+			// Unknown fields are rejected so that a misspelt setting is not silently ignored.
+			var p ProjectConfig
+			dec := yaml.NewDecoder(bytes.NewReader(buf))
+			dec.KnownFields(true)
+			if err := dec.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+
+			p.Path = path
+			return &p, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func loadProjectConfig() (*ProjectConfig, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return findProjectConfig(wd)
+}
@@ -0,0 +1,168 @@
+package command
+
+import (
+	"sort"
+	"strings"
+)
+
+// accountMatcher reports whether an account, whose normalized name is given, matches the name given by the user.
+type accountMatcher func(id string, acc *Account, normalized, name string) bool
+
+// accountMatchers are tried in order of precedence by accountSet.Find. The first matcher to match any accounts wins.
+var accountMatchers = []accountMatcher{
+	// Exact account ID
+	func(id string, _ *Account, _, name string) bool { return id == name },
+	// Alias. Purposefully case-sensitive as the user should match the alias they provided.
+	func(_ string, acc *Account, _, name string) bool { return acc.HasAlias(name) },
+	// Exact name
+	func(_ string, acc *Account, _, name string) bool { return strings.EqualFold(acc.Name, name) },
+	// Normalized name
+	func(_ string, _ *Account, normalized, name string) bool { return strings.EqualFold(normalized, name) },
+	// Prefix of the alias, name or normalized name
+	func(_ string, acc *Account, normalized, name string) bool {
+		name = strings.ToLower(name)
+		for _, candidate := range candidateNames(acc, normalized) {
+			if strings.HasPrefix(strings.ToLower(candidate), name) {
+				return true
+			}
+		}
+		return false
+	},
+	// Fuzzy match of the alias, name or normalized name, allowing for a single typo.
+	func(_ string, acc *Account, normalized, name string) bool {
+		if len(name) < minFuzzyMatchLength {
+			return false
+		}
+
+		for _, candidate := range candidateNames(acc, normalized) {
+			if editDistance(strings.ToLower(candidate), strings.ToLower(name)) <= 1 {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+const (
+	// minFuzzyMatchLength prevents very short names from fuzzily matching unrelated accounts.
+	minFuzzyMatchLength = 4
+	// maxSuggestions is the maximum number of accounts suggested when no account matches.
+	maxSuggestions = 3
+)
+
+// candidateNames returns the names a user might use to refer to the account.
+func candidateNames(acc *Account, normalized string) []string {
+	return append([]string{acc.Name, normalized}, acc.Aliases...)
+}
+
+// displayName returns the name that should be shown to the user when referring to the account.
+func (a *Account) displayName() string {
+	if alias := a.PrimaryAlias(); alias != "" {
+		return alias
+	}
+	return a.Name
+}
+
+// sortedIDs returns the IDs of all accounts in the set in a stable order.
+func (a accountSet) sortedIDs() []string {
+	ids := make([]string, 0, len(a.accounts))
+	for id := range a.accounts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Find finds the account referred to by name.
+//
+// Accounts are matched, in order of precedence, by exact ID, alias, exact name, normalized name, unique prefix, and finally by allowing a single typo.
+// If more than one account matches at the highest matching level, an AmbiguousAccountError is returned.
+// If no account matches, an error suggesting similarly named accounts is returned.
+func (a accountSet) Find(name string) (*Account, error) {
+	ids := a.sortedIDs()
+	for _, matches := range accountMatchers {
+		var found []*Account
+		for _, id := range ids {
+			if acc := a.accounts[id]; matches(id, acc, a.normalize(acc), name) {
+				found = append(found, acc)
+			}
+		}
+
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		default:
+			return nil, AmbiguousAccountError{Name: name, Candidates: found}
+		}
+	}
+
+	return nil, UnknownAccountError(name, FlagBypassCache, a.suggest(name)...)
+}
+
+// suggest returns the display names of accounts whose names are similar to the given name, most similar first.
+func (a accountSet) suggest(name string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	name = strings.ToLower(name)
+	threshold := max(2, len(name)/3)
+	var suggestions []suggestion
+	for _, id := range a.sortedIDs() {
+		acc := a.accounts[id]
+		best := -1
+		for _, candidate := range candidateNames(acc, a.normalize(acc)) {
+			if d := editDistance(strings.ToLower(candidate), name); best == -1 || d < best {
+				best = d
+			}
+		}
+
+		if best <= threshold {
+			suggestions = append(suggestions, suggestion{acc.displayName(), best})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+
+	var names []string
+	for i := 0; i < len(suggestions) && i < maxSuggestions; i++ {
+		names = append(names, suggestions[i].name)
+	}
+	return names
+}
+
+// editDistance returns the number of single-character insertions, deletions, substitutions or adjacent transpositions needed to turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// d[i][j] is the distance between the first i runes of a and the first j runes of b.
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAccountSet() accountSet {
+	var set accountSet
+	set.Add("1", Account{ID: "1", Name: "AWS - Production", Aliases: []string{"prod"}})
+	set.Add("2", Account{ID: "2", Name: "AWS - Staging", Aliases: []string{"staging"}})
+	set.Add("3", Account{ID: "3", Name: "AWS - Sandbox One"})
+	set.Add("4", Account{ID: "4", Name: "AWS - Sandbox Two"})
+	// This account's alias collides with the ID of another account, which should take precedence.
+	set.Add("5", Account{ID: "5", Name: "Legacy", Aliases: []string{"1"}})
+	return set
+}
+
+func TestAccountSetFindPrecedence(t *testing.T) {
+	set := newTestAccountSet()
+	tests := []struct {
+		name       string
+		expectedID string
+	}{
+		{"1", "1"},
+		{"prod", "1"},
+		{"AWS - staging", "2"},
+		{"sandbox one", "3"},
+		{"Stag", "2"},
+		{"Sandbox T", "4"},
+		{"stagign", "2"},
+		{"Legacy", "5"},
+	}
+
+	for _, tt := range tests {
+		acc, err := set.Find(tt.name)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expectedID, acc.ID, tt.name)
+	}
+}
+
+func TestAccountSetFindAmbiguous(t *testing.T) {
+	set := newTestAccountSet()
+	_, err := set.Find("Sandbox")
+
+	var ambiguousErr AmbiguousAccountError
+	require.ErrorAs(t, err, &ambiguousErr)
+	require.Len(t, ambiguousErr.Candidates, 2)
+	assert.Equal(t, "3", ambiguousErr.Candidates[0].ID)
+	assert.Equal(t, "4", ambiguousErr.Candidates[1].ID)
+	assert.Contains(t, err.Error(), "AWS - Sandbox One")
+
+	code, ok := GetExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, ExitCodeValueError, code)
+}
+
+func TestAccountSetFindIsDeterministicForDuplicateNames(t *testing.T) {
+	var set accountSet
+	set.Add("b", Account{ID: "b", Name: "AWS - Shared"})
+	set.Add("a", Account{ID: "a", Name: "Shared"})
+
+	// "Shared" matches account a by exact name and account b by normalized name; exact name wins every time.
+	for i := 0; i < 10; i++ {
+		acc, err := set.Find("shared")
+		require.NoError(t, err)
+		assert.Equal(t, "a", acc.ID)
+	}
+}
+
+func TestAccountSetFindSuggestsSimilarAccounts(t *testing.T) {
+	set := newTestAccountSet()
+	_, err := set.Find("prdouctoin")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Did you mean prod?")
+
+	_, err = set.Find("completely-unrelated")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "Did you mean")
+}
+
+func Test_editDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("prod", "prod"))
+	assert.Equal(t, 1, editDistance("prod", "prd"))
+	assert.Equal(t, 1, editDistance("prod", "rpod"))
+	assert.Equal(t, 1, editDistance("prod", "prods"))
+	assert.Equal(t, 3, editDistance("", "abc"))
+}
@@ -1,29 +1,60 @@
 package command
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/RobotsAndPencils/go-saml"
-	"github.com/riotgames/key-conjurer/pkg/oauth2cli"
+	"github.com/riotgames/key-conjurer/internal/apiclient"
 	"github.com/spf13/cobra"
+	"golang.org/x/oauth2"
 )
 
+func init() {
+	rolesCmd.Flags().String(FlagServerAddress, ServerAddress, "The address of the account server. This does not usually need to be changed or specified.")
+}
+
 var rolesCmd = cobra.Command{
 	Use:   "roles <accountName/alias>",
 	Short: "Returns the roles that you have access to in the given account.",
+	Long:  "Returns the roles that you have access to in the given account. Roles are requested from the account server, falling back to reading them from a SAML assertion if the account server is unable to provide them.",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config := ConfigFromCommand(cmd)
-		oidcDomain, _ := cmd.Flags().GetString(FlagOIDCDomain)
-		clientID, _ := cmd.Flags().GetString(FlagClientID)
+		serverAddr, _ := cmd.Flags().GetString(FlagServerAddress)
 
 		var applicationID = args[0]
-		account, ok := config.FindAccount(applicationID)
-		if ok {
+		account, err := config.ResolveAccount(applicationID)
+		var ambiguousErr AmbiguousAccountError
+		if errors.As(err, &ambiguousErr) {
+			return err
+		}
+
+		// If the account isn't in the cache, the value given is assumed to be an application ID.
+		if err == nil {
 			applicationID = account.ID
 		}
 
-		samlResponse, _, err := oauth2cli.DiscoverConfigAndExchangeTokenForAssertion(cmd.Context(), &keychainTokenSource{}, oidcDomain, clientID, applicationID)
+		if roles, err := fetchRolesFromServer(cmd.Context(), serverAddr, &keychainTokenSource{}, applicationID); err == nil {
+			for _, name := range roles {
+				cmd.Println(name)
+			}
+			return nil
+		}
+
+		provider, err := assertionSettingsFromFlags(cmd.Flags()).AssertionProvider()
+		if err != nil {
+			return err
+		}
+
+		samlResponse, _, err := exchangeTokenForAssertion(cmd.Context(), provider, applicationID)
 		if err != nil {
 			return err
 		}
@@ -36,6 +67,67 @@ var rolesCmd = cobra.Command{
 	},
 }
 
+// errNoRolesFromServer is returned by fetchRolesFromServer when the account server has no roles for an application.
+//
+// This is the case for applications whose roles come from group mappings rather than the profile of the user's assignment, which the account server cannot see.
+var errNoRolesFromServer = errors.New("the account server returned no roles")
+
+// fetchRolesFromServer asks the account server for the roles the user may assume in the application.
+//
+// An error is returned if the account server cannot provide roles, including when it returns none, in which case callers should fall back to reading them from a SAML assertion.
+func fetchRolesFromServer(ctx context.Context, serverAddr string, ts oauth2.TokenSource, applicationID string) ([]string, error) {
+	uri, err := url.Parse(serverAddr)
+	if err != nil || uri.Host == "" {
+		return nil, fmt.Errorf("invalid server address %q", serverAddr)
+	}
+
+	roles, err := apiclient.New(ctx, uri, ts).ListRoles(ctx, applicationID)
+	if err == nil && len(roles) == 0 {
+		err = errNoRolesFromServer
+	}
+
+	if err != nil {
+		slog.Debug("could not fetch roles from account server", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// pickRole asks the user to choose one of roles, reading the answer from in.
+func pickRole(in io.Reader, out io.Writer, roles []string) (string, error) {
+	if len(roles) == 1 {
+		return roles[0], nil
+	}
+
+	fmt.Fprintln(out, "Choose a role:")
+	for i, role := range roles {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, role)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "Role [1-%d]: ", len(roles))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.ErrUnexpectedEOF
+		}
+
+		answer := strings.TrimSpace(scanner.Text())
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(roles) {
+			return roles[n-1], nil
+		}
+
+		for _, role := range roles {
+			if strings.EqualFold(role, answer) {
+				return role, nil
+			}
+		}
+	}
+}
+
 type roleProviderPair struct {
 	RoleARN     string
 	ProviderARN string
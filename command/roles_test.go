@@ -1,10 +1,20 @@
 package command
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/RobotsAndPencils/go-saml"
+	"github.com/riotgames/key-conjurer/internal/api"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
 )
 
 func Test_findRoleInSAML_DoesntBreakIfYouHaveMultipleRoles(t *testing.T) {
@@ -20,3 +30,43 @@ func Test_findRoleInSAML_DoesntBreakIfYouHaveMultipleRoles(t *testing.T) {
 	require.Equal(t, "arn:cloud:iam::1234:saml-provider/Okta", pair.ProviderARN)
 	require.Equal(t, "arn:cloud:iam::1234:role/Admin", pair.RoleARN)
 }
+
+func TestPickRole(t *testing.T) {
+	roles := []string{"Admin", "ReadOnly"}
+
+	var out bytes.Buffer
+	role, err := pickRole(strings.NewReader("2\n"), &out, roles)
+	require.NoError(t, err)
+	assert.Equal(t, "ReadOnly", role)
+	assert.Contains(t, out.String(), "1) Admin")
+
+	role, err = pickRole(strings.NewReader("7\nadmin\n"), io.Discard, roles)
+	require.NoError(t, err)
+	assert.Equal(t, "Admin", role)
+
+	role, err = pickRole(strings.NewReader(""), io.Discard, []string{"Admin"})
+	require.NoError(t, err)
+	assert.Equal(t, "Admin", role, "a single role should be chosen without asking")
+
+	_, err = pickRole(strings.NewReader(""), io.Discard, roles)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestFetchRolesFromServer(t *testing.T) {
+	var roles []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(api.Application{ID: "0oa1", Name: "AWS - one", Roles: roles})
+	}))
+	defer srv.Close()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+
+	roles = []string{"Admin", "ReadOnly"}
+	got, err := fetchRolesFromServer(context.Background(), srv.URL, ts, "0oa1")
+	require.NoError(t, err)
+	assert.Equal(t, roles, got)
+
+	// Applications whose roles come from group mappings have no roles on the server, so the roles must be read from a SAML assertion instead.
+	roles = nil
+	_, err = fetchRolesFromServer(context.Background(), srv.URL, ts, "0oa1")
+	assert.ErrorIs(t, err, errNoRolesFromServer)
+}
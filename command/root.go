@@ -31,6 +31,7 @@ func init() {
 	rootCmd.AddCommand(&aliasCmd)
 	rootCmd.AddCommand(&unaliasCmd)
 	rootCmd.AddCommand(&rolesCmd)
+	rootCmd.AddCommand(configCmd)
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "config-path",
 		Short: "Print the absolute path to the configuration file",
@@ -70,13 +71,34 @@ To get started run the following commands:
 			return fmt.Errorf("failed to load config: %s", err)
 		}
 
-		// We don't care about this being cancelled.
+		project, err := loadProjectConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load project config: %s", err)
+		}
+
+		// The order these are applied in determines their precedence; see settingPrecedence.
+		if err := applyEnvironmentToFlags(cmd.Flags()); err != nil {
+			return err
+		}
+
+		if err := applyProjectConfigToFlags(cmd.Flags(), project); err != nil {
+			return err
+		}
+
+		if err := applySettingsToFlags(cmd.Flags(), &config); err != nil {
+			return err
+		}
+
+		// The timeout is cancelled by PersistentPostRunE. If the command fails the process exits, so it does not need to be cancelled then.
 		timeout, _ := cmd.Flags().GetInt(FlagTimeout)
-		nextCtx, _ := context.WithTimeout(cmd.Context(), time.Duration(timeout)*time.Second)
+		nextCtx, cancel := context.WithTimeout(cmd.Context(), time.Duration(timeout)*time.Second)
+		nextCtx = cancelContext(nextCtx, cancel)
+		nextCtx = ProjectConfigContext(nextCtx, project)
 		cmd.SetContext(ConfigContext(nextCtx, &config))
 		return nil
 	},
 	PersistentPostRunE: func(cmd *cobra.Command, _ []string) error {
+		defer cancelFromCommand(cmd)()
 		config := ConfigFromCommand(cmd)
 		if err := saveConfig(config); err != nil {
 			return fmt.Errorf("failed to save config: %s", err)
@@ -3,6 +3,7 @@ package command
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -10,6 +11,7 @@ import (
 func init() {
 	setCmd.AddCommand(setTTLCmd)
 	setCmd.AddCommand(setTimeRemainingCmd)
+	setCmd.AddCommand(setAccountCmd)
 }
 
 var setCmd = &cobra.Command{
@@ -51,3 +53,24 @@ var setTimeRemainingCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var setAccountCmd = &cobra.Command{
+	Use:   "account <accountName/alias> <key> <value>",
+	Short: "Sets a default value used when retrieving credentials for an account.",
+	Long: fmt.Sprintf(`Sets a default value used when retrieving credentials for an account.
+
+The get command uses these values when the corresponding flag is not specified. An empty value removes the setting.
+
+Supported keys: %s`, strings.Join(accountSettings, ", ")),
+	Example: "keyconjurer set account FooAccount role Admin",
+	Args:    cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := ConfigFromCommand(cmd)
+		account, err := config.ResolveAccount(args[0])
+		if err != nil {
+			return err
+		}
+
+		return account.SetSetting(args[1], args[2])
+	},
+}
@@ -0,0 +1,335 @@
+package command
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// settingSource describes where the effective value of a setting came from.
+type settingSource string
+
+const (
+	settingSourceDefault settingSource = "default"
+	settingSourceFile    settingSource = "file"
+	settingSourceProject settingSource = "project"
+	settingSourceEnv     settingSource = "env"
+	settingSourceFlag    settingSource = "flag"
+)
+
+// settingPrecedence describes the order in which sources are consulted, for use in help text.
+const settingPrecedence = `Values are taken from the first of the following places that has one:
+
+  1. A flag given on the command line.
+  2. An environment variable named KEYCONJURER_<FLAG>, for example KEYCONJURER_TTL or KEYCONJURER_OIDC_DOMAIN.
+     KEYCONJURER_OUTPUT only sets the output of get and switch, not the format used by config and alias list.
+  3. The ` + ProjectConfigFileName + ` file in the current directory or the nearest parent directory, which may set account, role, region and ttl.
+     The role, region and ttl are only used by get for the account named in the file, if it names one.
+  4. The configuration file, including per-account settings set with the set account command.
+  5. The default value.`
+
+// annotationSource is the flag annotation used to record that the value of a flag came from somewhere other than the command line.
+const annotationSource = "keyconjurer_source"
+
+// annotationNoEnvironment is the flag annotation used to mark flags which are not set from KEYCONJURER_<FLAG> environment variables.
+//
+// It is used for flags which share a name with a flag of another command but not its meaning, such as the --output flag of config list, so that an environment variable intended for one does not break the other.
+const annotationNoEnvironment = "keyconjurer_no_environment"
+
+// setting describes a single user-configurable value stored in the config file.
+//
+// The key of a setting is the same as the name of the command-line flag that overrides it, if any.
+type setting struct {
+	Key         string
+	Type        string
+	Description string
+	// ValidValues, if not empty, lists the only values the setting may have.
+	ValidValues []string
+	// Default returns the value used when the setting is not present in the config file or given as a flag.
+	Default func() string
+	// Get returns the value stored in the config file, or false if it is not present.
+	Get func(c *Config) (string, bool)
+	// Set stores a value which has already been validated in the config file. An empty string removes the value.
+	Set func(c *Config, value string)
+}
+
+const (
+	settingTypeUint   = "uint"
+	settingTypeString = "string"
+	settingTypeURL    = "url"
+)
+
+var settings = []setting{
+	{
+		Key:         "ttl",
+		Type:        settingTypeUint,
+		Description: "The default key timeout in hours.",
+		Default:     func() string { return strconv.FormatUint(uint64(DefaultTTL), 10) },
+		Get:         func(c *Config) (string, bool) { return formatUint(c.TTL) },
+		Set:         func(c *Config, value string) { c.TTL = parseUint(value) },
+	},
+	{
+		Key:         "time-remaining",
+		Type:        settingTypeUint,
+		Description: "Request new keys if the current keys expire within this many minutes.",
+		Default:     func() string { return strconv.FormatUint(uint64(DefaultTimeRemaining), 10) },
+		Get:         func(c *Config) (string, bool) { return formatUint(c.TimeRemaining) },
+		Set:         func(c *Config, value string) { c.TimeRemaining = parseUint(value) },
+	},
+	{
+		Key:         FlagOIDCDomain,
+		Type:        settingTypeURL,
+		Description: "The domain name of your OIDC server.",
+		Default:     func() string { return OIDCDomain },
+		Get:         func(c *Config) (string, bool) { return c.OIDCDomain, c.OIDCDomain != "" },
+		Set:         func(c *Config, value string) { c.OIDCDomain = value },
+	},
+	{
+		Key:         FlagClientID,
+		Type:        settingTypeString,
+		Description: "The OAuth2 Client ID for the application registered with your OIDC server.",
+		Default:     func() string { return ClientID },
+		Get:         func(c *Config) (string, bool) { return c.ClientID, c.ClientID != "" },
+		Set:         func(c *Config, value string) { c.ClientID = value },
+	},
+	{
+		Key:         FlagServerAddress,
+		Type:        settingTypeURL,
+		Description: "The address of the account server.",
+		Default:     func() string { return ServerAddress },
+		Get:         func(c *Config) (string, bool) { return c.ServerAddress, c.ServerAddress != "" },
+		Set:         func(c *Config, value string) { c.ServerAddress = value },
+	},
+	{
+		Key:         FlagAssertionProvider,
+		Type:        settingTypeString,
+		Description: "How SAML assertions are retrieved from your identity provider.",
+		ValidValues: permittedAssertionProviders,
+		Default:     func() string { return assertionProviderOkta },
+		Get:         func(c *Config) (string, bool) { return c.AssertionProvider, c.AssertionProvider != "" },
+		Set:         func(c *Config, value string) { c.AssertionProvider = value },
+	},
+	{
+		Key:         FlagAssertionURL,
+		Type:        settingTypeString,
+		Description: "If the assertion provider is http, the URL to retrieve SAML assertions from. {application} is replaced with the ID of the application.",
+		Default:     func() string { return "" },
+		Get:         func(c *Config) (string, bool) { return c.AssertionURL, c.AssertionURL != "" },
+		Set:         func(c *Config, value string) { c.AssertionURL = value },
+	},
+	{
+		Key:         FlagAccountsMaxAge,
+		Type:        settingTypeUint,
+		Description: "How old, in hours, the account list may be before get refreshes it automatically.",
+		Default:     func() string { return strconv.FormatUint(uint64(DefaultAccountsMaxAge), 10) },
+		Get:         func(c *Config) (string, bool) { return formatUint(c.AccountsMaxAge) },
+		Set:         func(c *Config, value string) { c.AccountsMaxAge = parseUint(value) },
+	},
+}
+
+func formatUint(v uint) (string, bool) {
+	return strconv.FormatUint(uint64(v), 10), v != 0
+}
+
+// parseUint parses a value which has already been validated by validateSettingValue.
+func parseUint(value string) uint {
+	v, _ := strconv.ParseUint(value, 10, 32)
+	return uint(v)
+}
+
+func settingKeys() []string {
+	keys := make([]string, len(settings))
+	for i, s := range settings {
+		keys[i] = s.Key
+	}
+	return keys
+}
+
+func findSetting(key string) (setting, error) {
+	idx := slices.IndexFunc(settings, func(s setting) bool { return s.Key == key })
+	if idx == -1 {
+		return setting{}, ValueError{Value: key, ValidValues: settingKeys()}
+	}
+	return settings[idx], nil
+}
+
+func validateSettingValue(s setting, value string) error {
+	if len(s.ValidValues) > 0 && !slices.Contains(s.ValidValues, value) {
+		return ValueError{Value: value, ValidValues: s.ValidValues}
+	}
+
+	switch s.Type {
+	case settingTypeUint:
+		if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+			return genericError{
+				Message:  fmt.Sprintf("%s must be a positive whole number, got %q", s.Key, value),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+	case settingTypeURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return genericError{
+				Message:  fmt.Sprintf("%s must be an absolute URL such as https://example.com, got %q", s.Key, value),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolvedSetting is the effective value of a setting.
+type resolvedSetting struct {
+	Key         string        `json:"key"`
+	Value       string        `json:"value"`
+	Source      settingSource `json:"source"`
+	Description string        `json:"description"`
+}
+
+// envVarName returns the name of the environment variable that can be used in place of the given flag.
+func envVarName(flag string) string {
+	return "KEYCONJURER_" + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// resolveSetting determines the effective value of a setting and where it came from.
+func resolveSetting(s setting, flags *pflag.FlagSet, c *Config, project *ProjectConfig) resolvedSetting {
+	r := resolvedSetting{Key: s.Key, Description: s.Description}
+	projectValues := project.FlagValues()
+	flag := flags.Lookup(s.Key)
+	if flag != nil && flag.Changed {
+		r.Value, r.Source = flag.Value.String(), settingSourceFlag
+		if src, ok := flag.Annotations[annotationSource]; ok {
+			r.Source = settingSource(src[0])
+		}
+	} else if v, ok := os.LookupEnv(envVarName(s.Key)); ok {
+		r.Value, r.Source = v, settingSourceEnv
+	} else if v, ok := projectValues[s.Key]; ok {
+		r.Value, r.Source = v, settingSourceProject
+	} else if v, ok := s.Get(c); ok {
+		r.Value, r.Source = v, settingSourceFile
+	} else {
+		r.Value, r.Source = s.Default(), settingSourceDefault
+	}
+	return r
+}
+
+// setFlagFromSource sets the value of a flag which was not given on the command line, recording where the value came from.
+//
+// The flag is marked as changed so that it takes precedence over values in the config file.
+func setFlagFromSource(flags *pflag.FlagSet, name, value string, source settingSource) error {
+	if err := flags.Set(name, value); err != nil {
+		return fmt.Errorf("invalid value %q for --%s from %s: %w", value, name, source, err)
+	}
+
+	return flags.SetAnnotation(name, annotationSource, []string{string(source)})
+}
+
+// flagFromProject reports whether the value of the named flag was taken from a project config.
+func flagFromProject(flags *pflag.FlagSet, name string) bool {
+	flag := flags.Lookup(name)
+	if flag == nil {
+		return false
+	}
+
+	src, ok := flag.Annotations[annotationSource]
+	return ok && len(src) > 0 && src[0] == string(settingSourceProject)
+}
+
+// applyEnvironmentToFlags sets any flags which were not given on the command line from their corresponding KEYCONJURER_<FLAG> environment variable.
+func applyEnvironmentToFlags(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "help" || flag.Name == "version" {
+			return
+		}
+
+		if _, ok := flag.Annotations[annotationNoEnvironment]; ok {
+			return
+		}
+
+		if v, ok := os.LookupEnv(envVarName(flag.Name)); ok {
+			err = setFlagFromSource(flags, flag.Name, v, settingSourceEnv)
+		}
+	})
+
+	return err
+}
+
+// applyProjectConfigToFlags sets any flags which were not given on the command line or through the environment from the project config.
+func applyProjectConfigToFlags(flags *pflag.FlagSet, project *ProjectConfig) error {
+	for name, value := range project.FlagValues() {
+		flag := flags.Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		if err := setFlagFromSource(flags, name, value, settingSourceProject); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applySettingsToFlags uses values from the config file as the values of any flags which were not explicitly given.
+func applySettingsToFlags(flags *pflag.FlagSet, c *Config) error {
+	for _, s := range settings {
+		flag := flags.Lookup(s.Key)
+		if flag == nil || flag.Changed {
+			continue
+		}
+
+		v, ok := s.Get(c)
+		if !ok {
+			continue
+		}
+
+		// Setting the value directly rather than using flags.Set() ensures the flag is not marked as changed.
+		if err := flag.Value.Set(v); err != nil {
+			return fmt.Errorf("invalid value for %s in config file: %w", s.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that every value in the config is acceptable.
+func (c *Config) Validate() error {
+	for _, s := range settings {
+		if v, ok := s.Get(c); ok {
+			if err := validateSettingValue(s, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.AliasRules.Validate(); err != nil {
+		return err
+	}
+
+	if c.Accounts == nil {
+		return nil
+	}
+
+	var err error
+	c.Accounts.ForEach(func(id string, acc Account, _ string) {
+		if err != nil {
+			return
+		}
+
+		if acc.OutputType != "" && !slices.Contains(permittedOutputTypes, acc.OutputType) {
+			err = fmt.Errorf("account %s: %w", id, ValueError{Value: acc.OutputType, ValidValues: permittedOutputTypes})
+		} else if acc.ShellType != "" && !slices.Contains(permittedShellTypes, acc.ShellType) {
+			err = fmt.Errorf("account %s: %w", id, ValueError{Value: acc.ShellType, ValidValues: permittedShellTypes})
+		} else if acc.Federation != "" && !slices.Contains(permittedFederations, acc.Federation) {
+			err = fmt.Errorf("account %s: %w", id, ValueError{Value: acc.Federation, ValidValues: permittedFederations})
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSettingPrecedence(t *testing.T) {
+	s, err := findSetting("ttl")
+	require.NoError(t, err)
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Uint("ttl", 1, "")
+
+	var config Config
+	r := resolveSetting(s, flags, &config, nil)
+	assert.Equal(t, resolvedSetting{Key: "ttl", Value: "1", Source: settingSourceDefault, Description: s.Description}, r)
+
+	config.TTL = 4
+	r = resolveSetting(s, flags, &config, nil)
+	assert.Equal(t, "4", r.Value)
+	assert.Equal(t, settingSourceFile, r.Source)
+
+	require.NoError(t, flags.Set("ttl", "8"))
+	r = resolveSetting(s, flags, &config, nil)
+	assert.Equal(t, "8", r.Value)
+	assert.Equal(t, settingSourceFlag, r.Source)
+}
+
+func TestApplySettingsToFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Uint("ttl", 1, "")
+	flags.String(FlagClientID, "", "")
+	require.NoError(t, flags.Set(FlagClientID, "from-flag"))
+
+	config := Config{TTL: 4, ClientID: "from-file"}
+	require.NoError(t, applySettingsToFlags(flags, &config))
+
+	ttl, _ := flags.GetUint("ttl")
+	assert.Equal(t, uint(4), ttl)
+	assert.False(t, flags.Changed("ttl"), "values from the config file should not be treated as explicitly given")
+
+	clientID, _ := flags.GetString(FlagClientID)
+	assert.Equal(t, "from-flag", clientID)
+}
+
+func TestValidateSettingValue(t *testing.T) {
+	ttl, _ := findSetting("ttl")
+	assert.NoError(t, validateSettingValue(ttl, "4"))
+	assert.Error(t, validateSettingValue(ttl, "-1"))
+	assert.Error(t, validateSettingValue(ttl, "four"))
+
+	domain, _ := findSetting(FlagOIDCDomain)
+	assert.NoError(t, validateSettingValue(domain, "https://example.okta.com"))
+	assert.Error(t, validateSettingValue(domain, "example.okta.com"))
+
+	provider, _ := findSetting(FlagAssertionProvider)
+	assert.NoError(t, validateSettingValue(provider, "http"))
+	assert.ErrorAs(t, validateSettingValue(provider, "keycloak"), &ValueError{})
+
+	_, err := findSetting("nope")
+	var valueErr ValueError
+	assert.ErrorAs(t, err, &valueErr)
+}
+
+func TestEnvironmentAndProjectConfigPrecedence(t *testing.T) {
+	newFlags := func() *pflag.FlagSet {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		flags.Uint(FlagTimeToLive, 1, "")
+		flags.String(FlagRegion, "us-west-2", "")
+		flags.String(FlagRoleName, "", "")
+		return flags
+	}
+
+	project := &ProjectConfig{Role: "Project", Region: "eu-west-1", TTL: 2}
+	config := Config{TTL: 4}
+	ttl, _ := findSetting("ttl")
+
+	t.Run("ProjectOverridesFile", func(t *testing.T) {
+		flags := newFlags()
+		require.NoError(t, applyProjectConfigToFlags(flags, project))
+		require.NoError(t, applySettingsToFlags(flags, &config))
+
+		v, _ := flags.GetUint(FlagTimeToLive)
+		assert.Equal(t, uint(2), v)
+		assert.Equal(t, settingSourceProject, resolveSetting(ttl, flags, &config, project).Source)
+	})
+
+	t.Run("EnvironmentOverridesProject", func(t *testing.T) {
+		t.Setenv("KEYCONJURER_TTL", "6")
+		t.Setenv("KEYCONJURER_ROLE", "Env")
+		flags := newFlags()
+		require.NoError(t, applyEnvironmentToFlags(flags))
+		require.NoError(t, applyProjectConfigToFlags(flags, project))
+		require.NoError(t, applySettingsToFlags(flags, &config))
+
+		v, _ := flags.GetUint(FlagTimeToLive)
+		assert.Equal(t, uint(6), v)
+		role, _ := flags.GetString(FlagRoleName)
+		assert.Equal(t, "Env", role)
+		region, _ := flags.GetString(FlagRegion)
+		assert.Equal(t, "eu-west-1", region)
+		assert.Equal(t, settingSourceEnv, resolveSetting(ttl, flags, &config, project).Source)
+	})
+
+	t.Run("FlagOverridesEnvironment", func(t *testing.T) {
+		t.Setenv("KEYCONJURER_TTL", "6")
+		flags := newFlags()
+		require.NoError(t, flags.Set(FlagTimeToLive, "8"))
+		require.NoError(t, applyEnvironmentToFlags(flags))
+
+		v, _ := flags.GetUint(FlagTimeToLive)
+		assert.Equal(t, uint(8), v)
+		assert.Equal(t, settingSourceFlag, resolveSetting(ttl, flags, &config, project).Source)
+	})
+
+	t.Run("InvalidEnvironmentValue", func(t *testing.T) {
+		t.Setenv("KEYCONJURER_TTL", "forever")
+		assert.Error(t, applyEnvironmentToFlags(newFlags()))
+	})
+}
+
+func TestFindProjectConfigSearchesParentDirectories(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ProjectConfigFileName), []byte("account: prod\nrole: Admin\nttl: 3\n"), 0644))
+
+	project, err := findProjectConfig(nested)
+	require.NoError(t, err)
+	require.NotNil(t, project)
+	assert.Equal(t, "prod", project.Account)
+	assert.Equal(t, "Admin", project.Role)
+	assert.Equal(t, uint(3), project.TTL)
+	assert.Equal(t, filepath.Join(root, ProjectConfigFileName), project.Path)
+
+	project, err = findProjectConfig(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, project)
+}
+
+func TestFindProjectConfigRejectsUnknownFields(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ProjectConfigFileName), []byte("account: prod\ntll: 3\n"), 0644))
+
+	_, err := findProjectConfig(dir)
+	assert.ErrorContains(t, err, "tll")
+}
+
+func TestApplyEnvironmentToFlagsSkipsOutputFormatFlags(t *testing.T) {
+	t.Setenv("KEYCONJURER_OUTPUT", outputTypeEnvironmentVariable)
+
+	for _, flags := range []*pflag.FlagSet{configCmd.PersistentFlags(), aliasListCmd.Flags()} {
+		flag := flags.Lookup(FlagOutputType)
+		require.NotNil(t, flag)
+
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.String(flag.Name, flag.DefValue, "")
+		fs.Lookup(flag.Name).Annotations = flag.Annotations
+		require.NoError(t, applyEnvironmentToFlags(fs))
+		assert.Equal(t, outputTypeText, fs.Lookup(FlagOutputType).Value.String(), "KEYCONJURER_OUTPUT is meant for get and switch")
+	}
+
+	getFlags := pflag.NewFlagSet("get", pflag.ContinueOnError)
+	getFlags.String(FlagOutputType, outputTypeAWSCredentialsFile, "")
+	require.NoError(t, applyEnvironmentToFlags(getFlags))
+	v, _ := getFlags.GetString(FlagOutputType)
+	assert.Equal(t, outputTypeEnvironmentVariable, v)
+}
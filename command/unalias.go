@@ -1,15 +1,32 @@
 package command
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
 )
 
 var unaliasCmd = cobra.Command{
-	Use:     "unalias <accountName/alias>",
-	Short:   "Remove alias from account.",
+	Use:   "unalias <accountName/alias>",
+	Short: "Remove alias from account.",
+	Long: `Remove an alias from an account.
+
+If an account name or ID is given instead of an alias, all of the aliases of that account are removed.`,
 	Args:    cobra.ExactArgs(1),
 	Example: "keyconjurer unalias bar",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		config := ConfigFromCommand(cmd)
-		config.Unalias(args[0])
+		removed := config.Unalias(args[0])
+		if len(removed) == 0 {
+			return genericError{
+				Message:  fmt.Sprintf("%q is not an alias or the name of an account with aliases", args[0]),
+				ExitCode: ExitCodeValueError,
+			}
+		}
+
+		if !ShouldUseMachineOutput(cmd.Flags()) {
+			cmd.PrintErrf("Removed %s\n", strings.Join(removed, ", "))
+		}
+		return nil
 	}}
@@ -0,0 +1,173 @@
+package command
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/riotgames/key-conjurer/pkg/oauth2cli"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// federationSAML retrieves credentials by exchanging a SAML assertion from the identity provider with AssumeRoleWithSAML. This is the default.
+	federationSAML = "saml"
+	// federationOIDC retrieves credentials by presenting the ID token obtained at login to AssumeRoleWithWebIdentity.
+	// This only works for roles which trust the OIDC provider directly.
+	federationOIDC       = "oidc"
+	permittedFederations = []string{federationSAML, federationOIDC}
+)
+
+// idTokenExpiryLeeway is how long an ID token must remain valid for it to be sent to AWS without being refreshed first.
+const idTokenExpiryLeeway = time.Minute
+
+// idTokenExpiry returns the expiry of an ID token.
+//
+// The token is not verified; AWS does that when it is presented.
+func idTokenExpiry(raw string) (time.Time, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("id token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decode id token: %w", err)
+	}
+
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("decode id token: %w", err)
+	}
+
+	return time.Unix(claims.Expiry, 0), nil
+}
+
+// refreshIDToken returns the ID token carried by tok, using its refresh token to obtain a new one from the token endpoint of cfg if it expires within idTokenExpiryLeeway of now.
+//
+// If a new ID token was obtained, the token it came with is also returned so that it can be stored. ErrTokensExpiredOrAbsent is returned if the ID token has expired and cannot be refreshed.
+func refreshIDToken(ctx context.Context, cfg *oauth2.Config, tok *oauth2.Token, now time.Time) (string, *oauth2.Token, error) {
+	idToken, _ := tok.Extra("id_token").(string)
+	if expiry, err := idTokenExpiry(idToken); err == nil && expiry.After(now.Add(idTokenExpiryLeeway)) {
+		return idToken, nil, nil
+	}
+
+	if tok.RefreshToken == "" {
+		return "", nil, ErrTokensExpiredOrAbsent
+	}
+
+	// Only the refresh token is given so that the token source always makes a refresh request; the access token may still be valid even though the ID token is not.
+	next, err := cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: tok.RefreshToken}).Token()
+	if err != nil {
+		slog.Debug("could not refresh id token", slog.String("error", err.Error()))
+		return "", nil, ErrTokensExpiredOrAbsent
+	}
+
+	idToken, ok := next.Extra("id_token").(string)
+	if !ok {
+		return "", nil, fmt.Errorf("id_token not found in refresh response")
+	}
+
+	return idToken, next, nil
+}
+
+// webIdentityToken returns the ID token stored in the keychain, refreshing it first if it has expired.
+func (g GetCommand) webIdentityToken(ctx context.Context) (string, error) {
+	tok, err := getAccountCredentialFromKeychain()
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := oauth2cli.DiscoverConfig(ctx, g.OIDCDomain, g.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	idToken, next, err := refreshIDToken(ctx, cfg, tok, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if next != nil {
+		if err := putAccountCredentialInKeychain(next, idToken); err != nil {
+			return "", err
+		}
+	}
+
+	return idToken, nil
+}
+
+// webIdentityRoleARN returns the ARN of the role to assume in an account which uses OIDC federation.
+//
+// The role given with --role, or the default role of the account, is used if there is one, and must be an ARN. Otherwise the role ARN set for the account is used.
+func (g GetCommand) webIdentityRoleARN(account Account) (string, error) {
+	switch {
+	case strings.HasPrefix(g.RoleName, "arn:"):
+		return g.RoleName, nil
+	case g.RoleName != "":
+		// The role name may have come from --role, the default role of the account or a project file; none of them can be used without an ARN.
+		return "", genericError{
+			Message:  fmt.Sprintf("%s uses OIDC federation, so its role must be given as an ARN, but got %q. Give the ARN with --%s or set one with: keyconjurer set account %s %s <arn>", account.Name, g.RoleName, FlagRoleName, account.ID, accountSettingRoleARN),
+			ExitCode: ExitCodeValueError,
+		}
+	case account.RoleARN != "":
+		return account.RoleARN, nil
+	}
+
+	return "", genericError{
+		Message:  fmt.Sprintf("%s uses OIDC federation but has no role ARN. Give one with --%s or set one with: keyconjurer set account %s %s <arn>", account.Name, FlagRoleName, account.ID, accountSettingRoleARN),
+		ExitCode: ExitCodeValueError,
+	}
+}
+
+// fetchWebIdentityCredentials retrieves credentials for an account which uses OIDC federation by presenting the user's ID token to AssumeRoleWithWebIdentity.
+func (g GetCommand) fetchWebIdentityCredentials(ctx context.Context, account Account) (*CloudCredentials, error) {
+	roleARN, err := g.webIdentityRoleARN(account)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := g.webIdentityToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// AssumeRoleWithWebIdentity is not signed, so no AWS credentials are needed.
+	stsClient := sts.New(sts.Options{Region: g.Region})
+	timeoutInSeconds := int32(3600 * g.TimeToLive)
+	resp, err := stsClient.AssumeRoleWithWebIdentity(ctx, &sts.AssumeRoleWithWebIdentityInput{
+		DurationSeconds:  aws.Int32(timeoutInSeconds),
+		RoleArn:          aws.String(roleARN),
+		RoleSessionName:  aws.String(g.RoleSessionName),
+		WebIdentityToken: aws.String(idToken),
+	})
+
+	if err, ok := tryParseTimeToLiveError(err); ok {
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, AWSError{
+			InnerError: err,
+			Message:    "failed to exchange credentials",
+		}
+	}
+
+	return &CloudCredentials{
+		AccountID:       account.ID,
+		AccessKeyID:     *resp.Credentials.AccessKeyId,
+		Expiration:      resp.Credentials.Expiration.Format(time.RFC3339),
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+	}, nil
+}
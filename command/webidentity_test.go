@@ -0,0 +1,106 @@
+package command
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// unsignedIDToken returns a JWT which expires at exp. The signature is not valid, which is fine because it is only checked by AWS.
+func unsignedIDToken(exp time.Time) string {
+	payload, _ := json.Marshal(map[string]any{"sub": "00u1", "exp": exp.Unix()})
+	return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func TestIDTokenExpiry(t *testing.T) {
+	exp := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	got, err := idTokenExpiry(unsignedIDToken(exp))
+	require.NoError(t, err)
+	assert.True(t, exp.Equal(got))
+
+	_, err = idTokenExpiry("opaque")
+	assert.Error(t, err)
+}
+
+func TestRefreshIDToken(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	refreshed := unsignedIDToken(now.Add(time.Hour))
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "refresh" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access2","token_type":"Bearer","expires_in":3600,"id_token":%q}`, refreshed)
+	}))
+	defer srv.Close()
+
+	cfg := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: srv.URL}}
+	ctx := context.Background()
+
+	t.Run("ValidTokenIsNotRefreshed", func(t *testing.T) {
+		valid := unsignedIDToken(now.Add(10 * time.Minute))
+		tok := (&oauth2.Token{RefreshToken: "refresh"}).WithExtra(map[string]any{"id_token": valid})
+		idToken, next, err := refreshIDToken(ctx, cfg, tok, now)
+		require.NoError(t, err)
+		assert.Equal(t, valid, idToken)
+		assert.Nil(t, next)
+		assert.Equal(t, 0, requests)
+	})
+
+	t.Run("ExpiredTokenIsRefreshed", func(t *testing.T) {
+		tok := (&oauth2.Token{AccessToken: "access", RefreshToken: "refresh", Expiry: now.Add(time.Hour)}).WithExtra(map[string]any{"id_token": unsignedIDToken(now)})
+		idToken, next, err := refreshIDToken(ctx, cfg, tok, now)
+		require.NoError(t, err)
+		assert.Equal(t, refreshed, idToken)
+		require.NotNil(t, next)
+		assert.Equal(t, "access2", next.AccessToken)
+		assert.Equal(t, "refresh", next.RefreshToken, "the refresh token should be kept when a new one is not issued")
+	})
+
+	t.Run("NoRefreshToken", func(t *testing.T) {
+		tok := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]any{"id_token": unsignedIDToken(now)})
+		_, _, err := refreshIDToken(ctx, cfg, tok, now)
+		assert.ErrorIs(t, err, ErrTokensExpiredOrAbsent)
+	})
+
+	t.Run("RefreshRejected", func(t *testing.T) {
+		tok := (&oauth2.Token{RefreshToken: "revoked"}).WithExtra(map[string]any{"id_token": unsignedIDToken(now)})
+		_, _, err := refreshIDToken(ctx, cfg, tok, now)
+		assert.ErrorIs(t, err, ErrTokensExpiredOrAbsent)
+	})
+}
+
+func TestWebIdentityRoleARN(t *testing.T) {
+	account := Account{ID: "1", Name: "test", Federation: federationOIDC, RoleARN: "arn:aws:iam::123456789012:role/Admin"}
+
+	arn, err := GetCommand{}.webIdentityRoleARN(account)
+	require.NoError(t, err)
+	assert.Equal(t, account.RoleARN, arn)
+
+	_, err = GetCommand{RoleName: "Admin"}.webIdentityRoleARN(account)
+	assert.ErrorContains(t, err, `must be given as an ARN, but got "Admin"`, "role names which are not ARNs cannot be assumed")
+
+	arn, err = GetCommand{RoleName: "arn:aws:iam::123456789012:role/ReadOnly"}.webIdentityRoleARN(account)
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:iam::123456789012:role/ReadOnly", arn)
+
+	account.RoleARN = ""
+	_, err = GetCommand{}.webIdentityRoleARN(account)
+	code, ok := GetExitCode(err)
+	assert.True(t, ok)
+	assert.Equal(t, ExitCodeValueError, code)
+}
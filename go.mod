@@ -20,6 +20,8 @@ require (
 	github.com/zalando/go-keyring v0.2.6
 	golang.org/x/net v0.25.0
 	golang.org/x/oauth2 v0.26.0
+	golang.org/x/sys v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -48,11 +50,9 @@ require (
 	github.com/pquerna/cachecontrol v0.2.0 // indirect
 	github.com/smartystreets/goconvey v0.0.0-20190330032615-68dc04aab96a // indirect
 	golang.org/x/crypto v0.23.0 // indirect
-	golang.org/x/sys v0.26.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/ini.v1 v1.42.0 // indirect
 	gopkg.in/square/go-jose.v2 v2.5.1 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 go 1.23.0
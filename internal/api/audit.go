@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"log/slog"
+)
+
+const (
+	auditOutcomeSuccess = "success"
+	auditOutcomeDenied  = "denied"
+	auditOutcomeError   = "error"
+	// auditOutcomeRateLimited is used for requests rejected by the rate limiter or because Okta is being backed off from.
+	auditOutcomeRateLimited = "rate_limited"
+)
+
+// AuditEvent describes a single request made on behalf of a user.
+type AuditEvent struct {
+	Time             time.Time `json:"time"`
+	Method           string    `json:"method"`
+	Path             string    `json:"path"`
+	Route            string    `json:"route"`
+	User             string    `json:"user,omitempty"`
+	SourceIP         string    `json:"source_ip,omitempty"`
+	TraceID          string    `json:"trace_id,omitempty"`
+	ApplicationID    string    `json:"application_id,omitempty"`
+	ApplicationCount int       `json:"application_count"`
+	Status           int       `json:"status"`
+	Outcome          string    `json:"outcome"`
+	Error            string    `json:"error,omitempty"`
+	LatencyMS        int64     `json:"latency_ms"`
+
+	// audited is set when a handler retrieves the event, indicating that the request was made on behalf of a user and should be audited.
+	audited bool
+}
+
+// AuditSink receives audit events.
+type AuditSink interface {
+	WriteAuditEvent(event AuditEvent) error
+}
+
+// JSONAuditSink writes each audit event to W as a single line of JSON.
+type JSONAuditSink struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+func (s *JSONAuditSink) WriteAuditEvent(event AuditEvent) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.W.Write(append(buf, '\n'))
+	return err
+}
+
+type auditEventKey struct{}
+
+// auditEvent returns the audit event for the request being served with ctx, marking the request as one that should be audited.
+//
+// If the request is not being audited, an event which is discarded is returned so that callers do not need to check.
+func auditEvent(ctx context.Context) *AuditEvent {
+	event, ok := ctx.Value(auditEventKey{}).(*AuditEvent)
+	if !ok {
+		event = &AuditEvent{}
+	}
+	event.audited = true
+	return event
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return auditOutcomeRateLimited
+	case status < 400:
+		return auditOutcomeSuccess
+	case status < 500:
+		return auditOutcomeDenied
+	default:
+		return auditOutcomeError
+	}
+}
+
+// sourceIP returns the address of the client which made r, which is the first address in the X-Forwarded-For header.
+func sourceIP(r Request) string {
+	ip, _, _ := strings.Cut(r.Header("x-forwarded-for"), ",")
+	return strings.TrimSpace(ip)
+}
+
+// Instrument wraps h so that every request is measured in metrics and requests made on behalf of a user are written to audit. Either may be nil.
+func Instrument(h Handler, audit AuditSink, metrics *Metrics) Handler {
+	return HandlerFunc(func(ctx context.Context, r Request) Response {
+		start := time.Now()
+		event := &AuditEvent{
+			Time:     start.UTC(),
+			Method:   r.Method,
+			Path:     r.Path,
+			Route:    routeUnmatched,
+			SourceIP: sourceIP(r),
+			TraceID:  r.Header("x-amzn-trace-id"),
+		}
+
+		w := h.Handle(context.WithValue(ctx, auditEventKey{}, event), r)
+		latency := time.Since(start)
+
+		event.Status = statusCode(w)
+		event.Outcome = auditOutcome(event.Status)
+		event.LatencyMS = latency.Milliseconds()
+		metrics.ObserveRequest(event.Route, event.Status, latency)
+
+		if audit != nil && event.audited {
+			if err := audit.WriteAuditEvent(*event); err != nil {
+				slog.Error("failed to write audit event", slog.String("error", err.Error()))
+			}
+		}
+
+		return w
+	})
+}
+
+// routeUnmatched is the route recorded for requests which did not match any route.
+const routeUnmatched = "unmatched"
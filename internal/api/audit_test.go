@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	var rt Router
+	rt.Route([]string{http.MethodPost}, "/v2/applications/{id}/roles", HandlerFunc(func(ctx context.Context, r Request) (w Response) {
+		event := auditEvent(ctx)
+		event.User = "user@example.com"
+		event.ApplicationID = r.PathParams["id"]
+		ServeJSONError(&w, http.StatusNotFound, "application not found")
+		return
+	}))
+	rt.Route([]string{http.MethodGet}, "/healthz", HandlerFunc(func(ctx context.Context, r Request) (w Response) {
+		return
+	}))
+
+	var buf bytes.Buffer
+	metrics := NewMetrics()
+	h := Instrument(&rt, &JSONAuditSink{W: &buf}, metrics)
+
+	h.Handle(context.Background(), Request{
+		Method:  http.MethodPost,
+		Path:    "/v2/applications/0oa1/roles",
+		Headers: map[string]string{"x-forwarded-for": "10.0.0.1, 10.0.0.2", "x-amzn-trace-id": "Root=1-abc"},
+	})
+	h.Handle(context.Background(), Request{Method: http.MethodGet, Path: "/healthz"})
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 1, "only requests made on behalf of a user should be audited")
+
+	var event AuditEvent
+	require.NoError(t, json.Unmarshal(lines[0], &event))
+	assert.Equal(t, "/v2/applications/{id}/roles", event.Route)
+	assert.Equal(t, "user@example.com", event.User)
+	assert.Equal(t, "10.0.0.1", event.SourceIP)
+	assert.Equal(t, "Root=1-abc", event.TraceID)
+	assert.Equal(t, "0oa1", event.ApplicationID)
+	assert.Equal(t, http.StatusNotFound, event.Status)
+	assert.Equal(t, auditOutcomeDenied, event.Outcome)
+
+	var out bytes.Buffer
+	require.NoError(t, metrics.Write(&out))
+	assert.Contains(t, out.String(), `keyconjurer_requests_total{route="/healthz",status="200"} 1`)
+	assert.Contains(t, out.String(), `keyconjurer_requests_total{route="/v2/applications/{id}/roles",status="404"} 1`)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheEntry is the list of applications for a user, along with when it was fetched and when it should no longer be used.
+// Other information about the user needed to serve requests is stored alongside the applications so that it expires with them.
+type CacheEntry struct {
+	Applications []Application `json:"applications"`
+	StoredAt     time.Time     `json:"stored_at"`
+	Expires      time.Time     `json:"expires"`
+	// Groups are the groups of the user. They are only fetched when the application filter requires groups, and are nil otherwise.
+	Groups []Group `json:"groups"`
+	// UserID is the ID of the user in the directory, if it has been looked up.
+	UserID string `json:"user_id,omitempty"`
+	// Roles maps the ID of each application to the roles the user may assume in it. Only applications whose roles have been requested are present.
+	Roles map[string][]string `json:"roles,omitempty"`
+}
+
+// ApplicationCache stores the applications of each user so that repeated requests do not need to page through the directory.
+// It also stores the IDs of users identified by a claim which must be looked up, such as their email address; those entries hold only a UserID.
+//
+// Implementations backed by external stores should use Expires to set the lifetime of the entry in the store. Errors are logged and otherwise treated as a cache miss.
+type ApplicationCache interface {
+	Get(ctx context.Context, user string) (CacheEntry, bool, error)
+	Set(ctx context.Context, user string, entry CacheEntry) error
+}
+
+// LRUCache is an in-memory ApplicationCache which holds a fixed number of entries, evicting the least recently used entry when full.
+type LRUCache struct {
+	capacity int
+	now      func() time.Time
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	user  string
+	entry CacheEntry
+}
+
+// NewLRUCache returns an LRUCache which holds up to capacity entries.
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		now:      time.Now,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(_ context.Context, user string) (CacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[user]
+	if !ok {
+		return CacheEntry{}, false, nil
+	}
+
+	item := elem.Value.(*lruItem)
+	if !c.now().Before(item.entry.Expires) {
+		c.ll.Remove(elem)
+		delete(c.items, user)
+		return CacheEntry{}, false, nil
+	}
+
+	c.ll.MoveToFront(elem)
+	return item.entry, true, nil
+}
+
+func (c *LRUCache) Set(_ context.Context, user string, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[user]; ok {
+		elem.Value.(*lruItem).entry = entry
+		c.ll.MoveToFront(elem)
+		return nil
+	}
+
+	c.items[user] = c.ll.PushFront(&lruItem{user: user, entry: entry})
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruItem).user)
+	}
+
+	return nil
+}
+
+// Len returns the number of entries in the cache, including any which have expired but not yet been evicted.
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// CacheStats counts how requests were served by an ApplicationCache.
+type CacheStats struct {
+	Hits, Misses, Bypasses atomic.Int64
+}
+
+// HitRate returns the fraction of requests which were allowed to use the cache and were served from it.
+func (s *CacheStats) HitRate() float64 {
+	hits, misses := s.Hits.Load(), s.Misses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+const (
+	cacheStatusHit    = "hit"
+	cacheStatusMiss   = "miss"
+	cacheStatusBypass = "bypass"
+)
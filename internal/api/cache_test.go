@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingDirectory struct {
+	calls, groupCalls, lookups int
+	apps                       []Application
+	groups                     []Group
+}
+
+func (o *countingDirectory) ListApplicationsForUser(ctx context.Context, user string) ([]Application, error) {
+	o.calls++
+	return o.apps, nil
+}
+
+func (o *countingDirectory) ListGroupsForUser(ctx context.Context, user string) ([]Group, error) {
+	o.groupCalls++
+	return o.groups, nil
+}
+
+func (o *countingDirectory) ListRolesForUser(ctx context.Context, user, appID string) ([]string, error) {
+	return nil, nil
+}
+
+func (o *countingDirectory) LookupUserID(ctx context.Context, claim, value string) (string, error) {
+	o.lookups++
+	return "00u1", nil
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUCache(2)
+	entry := CacheEntry{Expires: time.Now().Add(time.Hour)}
+
+	require.NoError(t, cache.Set(ctx, "a", entry))
+	require.NoError(t, cache.Set(ctx, "b", entry))
+	_, ok, _ := cache.Get(ctx, "a")
+	require.True(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "c", entry))
+	assert.Equal(t, 2, cache.Len())
+
+	_, ok, _ = cache.Get(ctx, "b")
+	assert.False(t, ok, "b was the least recently used entry and should have been evicted")
+	_, ok, _ = cache.Get(ctx, "a")
+	assert.True(t, ok)
+	_, ok, _ = cache.Get(ctx, "c")
+	assert.True(t, ok)
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewLRUCache(10)
+	cache.now = func() time.Time { return now }
+
+	require.NoError(t, cache.Set(ctx, "a", CacheEntry{StoredAt: now, Expires: now.Add(time.Minute)}))
+	_, ok, _ := cache.Get(ctx, "a")
+	assert.True(t, ok)
+
+	now = now.Add(time.Minute)
+	_, ok, _ = cache.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestListApplicationsUsesCache(t *testing.T) {
+	ctx := context.Background()
+	directory := &countingDirectory{apps: []Application{{Type: AppNameAWS, Name: "AWS - one"}}}
+	h := ServeUserApplicationsHandler{
+		Directory:  directory,
+		Cache:      NewLRUCache(10),
+		CacheTTL:   time.Minute,
+		CacheStats: &CacheStats{},
+	}
+
+	apps, status, _, err := h.listApplications(ctx, "user", false, nil)
+	require.NoError(t, err)
+	assert.Len(t, apps, 1)
+	assert.Equal(t, cacheStatusMiss, status)
+
+	_, status, entry, err := h.listApplications(ctx, "user", false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cacheStatusHit, status)
+	assert.Equal(t, 1, directory.calls)
+
+	var w Response
+	setCacheHeaders(&w, status, entry)
+	assert.Equal(t, "hit", w.Headers["X-Cache"])
+	assert.Regexp(t, `^private, max-age=(59|60)$`, w.Headers["Cache-Control"])
+
+	_, status, _, err = h.listApplications(ctx, "user", true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cacheStatusBypass, status)
+	assert.Equal(t, 2, directory.calls)
+
+	assert.Equal(t, int64(1), h.CacheStats.Hits.Load())
+	assert.Equal(t, int64(1), h.CacheStats.Misses.Load())
+	assert.Equal(t, int64(1), h.CacheStats.Bypasses.Load())
+	assert.Equal(t, 0.5, h.CacheStats.HitRate())
+}
+
+func TestListApplicationsWithoutCache(t *testing.T) {
+	h := ServeUserApplicationsHandler{Directory: &countingDirectory{}}
+
+	_, status, entry, err := h.listApplications(context.Background(), "user", false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "", status)
+
+	var w Response
+	setCacheHeaders(&w, status, entry)
+	assert.Equal(t, "private, no-store", w.Headers["Cache-Control"])
+}
+
+func TestAllowedApplicationsCachesGroups(t *testing.T) {
+	ctx := context.Background()
+	directory := &countingDirectory{apps: []Application{{Type: AppNameAWS, Name: "AWS - one"}}}
+	h := ServeUserApplicationsHandler{
+		Directory:      directory,
+		Filter:         &ApplicationFilter{AppNames: []string{AppNameAWS}, RequiredGroups: []string{"aws-users"}},
+		Cache:          NewLRUCache(10),
+		CacheTTL:       time.Minute,
+		OktaRateLimits: NewOktaRateLimits(0.1),
+	}
+
+	apps, _, _, err := h.allowedApplications(ctx, "user", false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, apps, "the user is not a member of a required group")
+
+	apps, status, entry, err := h.allowedApplications(ctx, "user", false, nil)
+	require.NoError(t, err)
+	assert.Empty(t, apps)
+	assert.Equal(t, cacheStatusHit, status)
+	assert.NotNil(t, entry.Groups, "an empty list of groups should still be cached")
+	assert.Equal(t, 1, directory.groupCalls)
+
+	directory.groups = []Group{{ID: "00g1", Name: "aws-users"}}
+	h.OktaRateLimits.Observe(oktaRateLimitHeaders(100, 0, time.Now().Add(time.Minute)))
+	_, _, _, err = h.allowedApplications(ctx, "user", true, nil)
+	require.NoError(t, err, "the cached entry should be served while backing off")
+	assert.Equal(t, 1, directory.groupCalls)
+}
+
+func TestListApplicationsIgnoresEntriesWithoutGroups(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	directory := &countingDirectory{groups: []Group{{ID: "00g1", Name: "aws-users"}}}
+	h := ServeUserApplicationsHandler{
+		Directory: directory,
+		Filter:    &ApplicationFilter{RequiredGroups: []string{"aws-users"}},
+		Cache:     NewLRUCache(10),
+		CacheTTL:  time.Minute,
+	}
+
+	require.NoError(t, h.Cache.Set(ctx, "user", CacheEntry{StoredAt: now, Expires: now.Add(time.Minute)}))
+	_, status, entry, err := h.listApplications(ctx, "user", false, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cacheStatusMiss, status)
+	assert.Equal(t, directory.groups, entry.Groups)
+}
+
+func TestIdentifyUserCachesLookedUpID(t *testing.T) {
+	ctx := context.Background()
+	directory := &countingDirectory{}
+	h := ServeUserApplicationsHandler{
+		Directory:      directory,
+		UserClaim:      UserClaimEmail,
+		Cache:          NewLRUCache(10),
+		CacheTTL:       time.Minute,
+		OktaRateLimits: NewOktaRateLimits(0.1),
+	}
+	claims := Claims{Raw: map[string]any{UserClaimEmail: "user@example.com"}}
+
+	id, err := h.identifyUser(ctx, claims)
+	require.NoError(t, err)
+	assert.Equal(t, "00u1", id)
+
+	h.OktaRateLimits.Observe(oktaRateLimitHeaders(100, 0, time.Now().Add(time.Minute)))
+	id, err = h.identifyUser(ctx, claims)
+	require.NoError(t, err, "the cached ID should be used while backing off")
+	assert.Equal(t, "00u1", id)
+	assert.Equal(t, 1, directory.lookups)
+
+	_, err = h.identifyUser(ctx, Claims{Raw: map[string]any{UserClaimEmail: "other@example.com"}})
+	var backoff *OktaBackoffError
+	assert.ErrorAs(t, err, &backoff, "an uncached user should not be looked up while backing off")
+	assert.Equal(t, 1, directory.lookups)
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// The claims which may be used to identify the user making a request.
+const (
+	// UserClaimPreferredUsername identifies users by their Okta login. This is the default.
+	UserClaimPreferredUsername = "preferred_username"
+	// UserClaimSub identifies users by the subject of the token, which Okta sets to the ID of the user.
+	UserClaimSub = "sub"
+	// UserClaimEmail identifies users by their primary email address, which is looked up in Okta.
+	UserClaimEmail = "email"
+)
+
+// ErrUserNotFound is returned when the claims of a token do not identify exactly one Okta user.
+var ErrUserNotFound = errors.New("user not found")
+
+// decodeClaims decodes the claims of a token or userinfo response using decode, which is expected to behave like json.Unmarshal.
+func decodeClaims(decode func(v any) error) (Claims, error) {
+	var claims Claims
+	if err := decode(&claims); err != nil {
+		return Claims{}, err
+	}
+
+	if err := decode(&claims.Raw); err != nil {
+		return Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// Value returns the value of the claim name, or an empty string if it is absent or is not a string.
+func (c Claims) Value(name string) string {
+	v, _ := c.Raw[name].(string)
+	return v
+}
+
+func (s ServeUserApplicationsHandler) userClaim() string {
+	if s.UserClaim == "" {
+		return UserClaimPreferredUsername
+	}
+	return s.UserClaim
+}
+
+// identifyUser returns the Okta user ID or login of the user claims belong to.
+func (s ServeUserApplicationsHandler) identifyUser(ctx context.Context, claims Claims) (string, error) {
+	claim := s.userClaim()
+	value := claims.Value(claim)
+	if value == "" {
+		return "", fmt.Errorf("%w: the %s claim is missing", ErrUserNotFound, claim)
+	}
+
+	switch claim {
+	case UserClaimPreferredUsername, UserClaimSub:
+		// Okta accepts either the ID or the login of a user wherever a user ID is expected.
+		return value, nil
+	}
+
+	// The ID is cached so that requests served from the cache do not need to look the user up in the directory either.
+	key := userIDCacheKey(claim, value)
+	if s.Cache != nil {
+		entry, ok, err := s.Cache.Get(ctx, key)
+		if err != nil {
+			slog.Warn("failed to read from application cache", slog.String("error", err.Error()))
+		}
+
+		if ok && entry.UserID != "" {
+			return entry.UserID, nil
+		}
+	}
+
+	if backoff := s.OktaRateLimits.Backoff(); backoff > 0 {
+		return "", &OktaBackoffError{RetryAfter: backoff}
+	}
+
+	id, err := s.Directory.LookupUserID(ctx, claim, value)
+	if err != nil {
+		return "", err
+	}
+
+	if s.Cache != nil {
+		now := time.Now()
+		if err := s.Cache.Set(ctx, key, CacheEntry{UserID: id, StoredAt: now, Expires: now.Add(s.CacheTTL)}); err != nil {
+			slog.Warn("failed to write to application cache", slog.String("error", err.Error()))
+		}
+	}
+
+	return id, nil
+}
+
+// userIDCacheKey is the key under which the ID of the user whose claim has value is cached. It cannot collide with the ID or login of a user, which are used as the keys of their applications.
+func userIDCacheKey(claim, value string) string {
+	return "claim:" + claim + ":" + value
+}
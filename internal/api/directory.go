@@ -0,0 +1,23 @@
+package api
+
+import "context"
+
+// ApplicationDirectory is an identity provider backend which knows which applications each user may access.
+//
+// Okta is the primary implementation. StaticDirectory reads the same information from a file.
+type ApplicationDirectory interface {
+	// ListApplicationsForUser returns every application assigned to user, before any ApplicationFilter is applied.
+	ListApplicationsForUser(ctx context.Context, user string) ([]Application, error)
+	// ListGroupsForUser returns the groups user is a member of.
+	ListGroupsForUser(ctx context.Context, user string) ([]Group, error)
+	// ListRolesForUser returns the names of the roles the user with the ID userID, as returned by LookupUserID, may assume in the application appID.
+	ListRolesForUser(ctx context.Context, userID, appID string) ([]string, error)
+	// LookupUserID returns the identifier of the user whose claim has value, or an error wrapping ErrUserNotFound if there is no such user.
+	LookupUserID(ctx context.Context, claim, value string) (string, error)
+}
+
+// Group is a group of users in an ApplicationDirectory.
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
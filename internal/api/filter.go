@@ -0,0 +1,64 @@
+package api
+
+import (
+	"regexp"
+	"slices"
+)
+
+// AppNameAWS is the name Okta gives to applications created from the AWS Account Federation integration.
+const AppNameAWS = "amazon_aws"
+
+// ApplicationFilter decides which of a user's applications are served to the CLI.
+//
+// An application is served only if it passes every criterion which is set. DenyIDs takes precedence over everything else.
+type ApplicationFilter struct {
+	// AppNames lists the application types, such as amazon_aws, which are served. If empty, applications of any kind are served.
+	AppNames []string
+	// LabelPattern, if set, must match the label of the application.
+	LabelPattern *regexp.Regexp
+	// AllowIDs, if not empty, lists the only application instance IDs which are served.
+	AllowIDs []string
+	// DenyIDs lists application instance IDs which are never served.
+	DenyIDs []string
+	// RequiredGroups, if not empty, lists groups by ID or name. Users who are not a member of at least one of them are not served any applications.
+	RequiredGroups []string
+}
+
+// DefaultApplicationFilter serves only applications created from the AWS Account Federation integration.
+var DefaultApplicationFilter = ApplicationFilter{AppNames: []string{AppNameAWS}}
+
+// Allow reports whether app should be served.
+func (f ApplicationFilter) Allow(app Application) bool {
+	if slices.Contains(f.DenyIDs, app.ID) {
+		return false
+	}
+
+	if len(f.AllowIDs) > 0 && !slices.Contains(f.AllowIDs, app.ID) {
+		return false
+	}
+
+	if len(f.AppNames) > 0 && !slices.Contains(f.AppNames, app.Type) {
+		return false
+	}
+
+	if f.LabelPattern != nil && !f.LabelPattern.MatchString(app.Name) {
+		return false
+	}
+
+	return true
+}
+
+// AllowGroups reports whether a member of groups satisfies RequiredGroups.
+func (f ApplicationFilter) AllowGroups(groups []Group) bool {
+	if len(f.RequiredGroups) == 0 {
+		return true
+	}
+
+	for _, group := range groups {
+		if slices.Contains(f.RequiredGroups, group.ID) || slices.Contains(f.RequiredGroups, group.Name) {
+			return true
+		}
+	}
+
+	return false
+}
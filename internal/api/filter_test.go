@@ -0,0 +1,43 @@
+package api
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplicationFilter(t *testing.T) {
+	aws := Application{ID: "1", Type: AppNameAWS, Name: "AWS - prod"}
+	custom := Application{ID: "2", Type: "riot_aws_saml", Name: "AWS - sandbox"}
+	other := Application{ID: "3", Type: "slack", Name: "Slack"}
+
+	tests := []struct {
+		name   string
+		filter ApplicationFilter
+		want   []bool
+	}{
+		{"default", DefaultApplicationFilter, []bool{true, false, false}},
+		{"any app name", ApplicationFilter{}, []bool{true, true, true}},
+		{"several app names", ApplicationFilter{AppNames: []string{AppNameAWS, "riot_aws_saml"}}, []bool{true, true, false}},
+		{"label pattern", ApplicationFilter{LabelPattern: regexp.MustCompile(`^AWS - `)}, []bool{true, true, false}},
+		{"allow list", ApplicationFilter{AllowIDs: []string{"2", "3"}}, []bool{false, true, true}},
+		{"deny list wins", ApplicationFilter{AllowIDs: []string{"2", "3"}, DenyIDs: []string{"3"}}, []bool{false, true, false}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := []bool{tc.filter.Allow(aws), tc.filter.Allow(custom), tc.filter.Allow(other)}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestApplicationFilterAllowGroups(t *testing.T) {
+	groups := []Group{{ID: "00g1", Name: "aws-users"}}
+
+	assert.True(t, ApplicationFilter{}.AllowGroups(nil))
+	assert.True(t, ApplicationFilter{RequiredGroups: []string{"00g1"}}.AllowGroups(groups))
+	assert.True(t, ApplicationFilter{RequiredGroups: []string{"aws-users"}}.AllowGroups(groups))
+	assert.False(t, ApplicationFilter{RequiredGroups: []string{"admins"}}.AllowGroups(groups))
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"log/slog"
+
+	"github.com/coreos/go-oidc"
+)
+
+// APIVersion is incremented whenever a backwards-incompatible change is made to the API served by the account server.
+//
+// Clients compare it with the version they were built against to warn users when they need to upgrade.
+const APIVersion = 2
+
+// readinessCheckTimeout bounds how long each readiness check may take.
+const readinessCheckTimeout = 2 * time.Second
+
+// VersionInfo describes the build of the account server.
+type VersionInfo struct {
+	Version        string `json:"version"`
+	BuildTimestamp string `json:"build_timestamp,omitempty"`
+	GoVersion      string `json:"go_version"`
+	APIVersion     int    `json:"api_version"`
+}
+
+// ReadinessCheck reports whether a dependency of the server is usable.
+type ReadinessCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// OIDCReadinessCheck returns a ReadinessCheck which fetches the JSON Web Key Set of idp, which is needed to verify tokens, to check that the provider can be reached.
+func OIDCReadinessCheck(idp *oidc.Provider, client *http.Client) ReadinessCheck {
+	return ReadinessCheck{Name: "oidc", Check: func(ctx context.Context) error {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+
+		if err := idp.Claims(&discovery); err != nil {
+			return err
+		}
+
+		if discovery.JWKSURI == "" {
+			return errors.New("the OIDC provider does not publish a JWKS URI")
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("the OIDC provider responded with status code %d", resp.StatusCode)
+		}
+		return nil
+	}}
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthHandler serves endpoints used by load balancers and deployment tooling to check the server.
+type HealthHandler struct {
+	Checks         []ReadinessCheck
+	Version        string
+	BuildTimestamp string
+}
+
+// HandleHealthz reports that the process is alive. It does not check any dependencies.
+func (h HealthHandler) HandleHealthz(ctx context.Context, r Request) (w Response) {
+	ServeJSON(&w, readinessResponse{Status: "ok"})
+	return
+}
+
+// HandleReadyz runs every readiness check, responding with 503 Service Unavailable if any of them fail.
+func (h HealthHandler) HandleReadyz(ctx context.Context, r Request) (w Response) {
+	resp := readinessResponse{Status: "ok", Checks: make(map[string]string)}
+	for _, check := range h.Checks {
+		checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+		err := check.Check(checkCtx)
+		cancel()
+
+		if err != nil {
+			slog.Warn("readiness check failed", slog.String("check", check.Name), slog.String("error", err.Error()))
+			resp.Status = "unavailable"
+			resp.Checks[check.Name] = err.Error()
+			continue
+		}
+
+		resp.Checks[check.Name] = "ok"
+	}
+
+	if resp.Status != "ok" {
+		w.StatusCode = http.StatusServiceUnavailable
+	}
+
+	ServeJSON(&w, resp)
+	return
+}
+
+// HandleVersion serves the VersionInfo of the server.
+func (h HealthHandler) HandleVersion(ctx context.Context, r Request) (w Response) {
+	ServeJSON(&w, VersionInfo{
+		Version:        h.Version,
+		BuildTimestamp: h.BuildTimestamp,
+		GoVersion:      runtime.Version(),
+		APIVersion:     APIVersion,
+	})
+	return
+}
+
+// Register adds the routes served by h to rt.
+func (h HealthHandler) Register(rt *Router) {
+	methods := []string{http.MethodGet, http.MethodHead}
+	rt.Route(methods, "/healthz", HandlerFunc(h.HandleHealthz))
+	rt.Route(methods, "/readyz", HandlerFunc(h.HandleReadyz))
+	rt.Route(methods, "/version", HandlerFunc(h.HandleVersion))
+}
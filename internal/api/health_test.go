@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	okta := errors.New("okta unreachable")
+	h := HealthHandler{
+		Version: "1.2.3",
+		Checks: []ReadinessCheck{
+			{Name: "oidc", Check: func(ctx context.Context) error { return nil }},
+			{Name: "okta", Check: func(ctx context.Context) error { return okta }},
+		},
+	}
+
+	var rt Router
+	h.Register(&rt)
+
+	w := rt.Handle(context.Background(), Request{Method: http.MethodGet, Path: "/healthz"})
+	assert.Equal(t, 0, w.StatusCode)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body)
+
+	w = rt.Handle(context.Background(), Request{Method: http.MethodGet, Path: "/readyz"})
+	assert.Equal(t, http.StatusServiceUnavailable, w.StatusCode)
+	assert.JSONEq(t, `{"status":"unavailable","checks":{"oidc":"ok","okta":"okta unreachable"}}`, w.Body)
+
+	okta = nil
+	w = rt.Handle(context.Background(), Request{Method: http.MethodGet, Path: "/readyz"})
+	assert.Equal(t, 0, w.StatusCode)
+
+	w = rt.Handle(context.Background(), Request{Method: http.MethodGet, Path: "/version"})
+	var info VersionInfo
+	require.NoError(t, json.Unmarshal([]byte(w.Body), &info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, APIVersion, info.APIVersion)
+}
+
+func TestOIDCReadinessCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+	})
+
+	keysStatus := http.StatusOK
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(keysStatus)
+		w.Write([]byte(`{"keys":[]}`))
+	})
+
+	idp, err := oidc.NewProvider(context.Background(), srv.URL)
+	require.NoError(t, err)
+
+	check := OIDCReadinessCheck(idp, srv.Client())
+	assert.NoError(t, check.Check(context.Background()))
+
+	keysStatus = http.StatusInternalServerError
+	assert.Error(t, check.Check(context.Background()))
+
+	srv.Close()
+	assert.Error(t, check.Check(context.Background()), "the check should fail once the provider cannot be reached")
+}
@@ -4,9 +4,6 @@ import (
 	"strings"
 
 	"log/slog"
-
-	"github.com/aws/aws-lambda-go/events"
-	"golang.org/x/oauth2"
 )
 
 // RequestAttrs returns attributes to be used with slog for the given request.
@@ -14,7 +11,7 @@ import (
 // []any is returned instead of []slog.Attr to make it easier to supply the attributes to slog functions using spread, for example:
 //
 //	slog.Error(msg, RequestAttrs(r)...)
-func RequestAttrs(r events.ALBTargetGroupRequest) []any {
+func RequestAttrs(r Request) []any {
 	var attrs []any
 
 	if v, ok := r.Headers["x-amzn-trace-id"]; ok {
@@ -28,20 +25,20 @@ func RequestAttrs(r events.ALBTargetGroupRequest) []any {
 	return attrs
 }
 
-func requestTokenSource(r events.ALBTargetGroupRequest) (oauth2.TokenSource, bool) {
+// requestBearerToken returns the bearer token from the Authorization header of r.
+func requestBearerToken(r Request) (string, bool) {
 	headerValue, ok := r.Headers["authorization"]
 	if !ok {
-		return nil, false
+		return "", false
 	}
 
 	parts := strings.Split(headerValue, " ")
 	if len(parts) != 2 {
-		return nil, false
+		return "", false
 	}
 	if parts[0] != "Bearer" {
-		return nil, false
+		return "", false
 	}
 
-	token := oauth2.Token{AccessToken: parts[1]}
-	return oauth2.StaticTokenSource(&token), true
+	return parts[1], true
 }
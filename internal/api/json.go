@@ -4,11 +4,9 @@ import (
 	"encoding/json"
 
 	"log/slog"
-
-	"github.com/aws/aws-lambda-go/events"
 )
 
-func ServeJSON[T any](w *events.ALBTargetGroupResponse, data T) {
+func ServeJSON[T any](w *Response, data T) {
 	buf, err := json.Marshal(data)
 	if err != nil {
 		// Nothing to be done here
@@ -28,7 +26,7 @@ type JSONError struct {
 	Message string `json:"error"`
 }
 
-func ServeJSONError(w *events.ALBTargetGroupResponse, statusCode int, msg string) {
+func ServeJSONError(w *Response, statusCode int, msg string) {
 	w.StatusCode = statusCode
 	ServeJSON(w, JSONError{Message: msg})
 }
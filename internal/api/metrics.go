@@ -0,0 +1,220 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDurationBuckets are the upper bounds, in seconds, of the buckets used by duration histograms.
+var defaultDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// pageBuckets are the upper bounds of the buckets used to count the number of pages fetched from Okta.
+var pageBuckets = []float64{1, 2, 3, 5, 10, 20, 50}
+
+// Metrics records measurements of the account server and writes them in the Prometheus text exposition format.
+//
+// All methods may be called on a nil *Metrics, in which case they do nothing.
+type Metrics struct {
+	requests        *counterVec
+	requestDuration *histogramVec
+	oktaDuration    *histogramVec
+	oktaPages       *histogramVec
+	// CacheStats, if set, is reported as the number of requests served from or bypassing the app link cache.
+	CacheStats *CacheStats
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:        newCounterVec("keyconjurer_requests_total", "Requests served, by route and status code.", "route", "status"),
+		requestDuration: newHistogramVec("keyconjurer_request_duration_seconds", "Time taken to serve requests, by route.", defaultDurationBuckets, "route"),
+		oktaDuration:    newHistogramVec("keyconjurer_okta_request_duration_seconds", "Time taken by calls to the Okta API, including every page, by operation.", defaultDurationBuckets, "operation"),
+		oktaPages:       newHistogramVec("keyconjurer_okta_pages", "Number of pages fetched from the Okta API per call, by operation.", pageBuckets, "operation"),
+	}
+}
+
+// ObserveRequest records that a request to route was served with status in d.
+func (m *Metrics) ObserveRequest(route string, status int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.Add(1, route, strconv.Itoa(status))
+	m.requestDuration.Observe(d.Seconds(), route)
+}
+
+// ObserveOkta records that a call to the Okta API named operation took d and fetched pages pages.
+func (m *Metrics) ObserveOkta(operation string, d time.Duration, pages int) {
+	if m == nil {
+		return
+	}
+	m.oktaDuration.Observe(d.Seconds(), operation)
+	m.oktaPages.Observe(float64(pages), operation)
+}
+
+// Write writes every metric to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+
+	for _, v := range []interface{ write(io.Writer) error }{m.requests, m.requestDuration, m.oktaDuration, m.oktaPages} {
+		if err := v.write(w); err != nil {
+			return err
+		}
+	}
+
+	if m.CacheStats == nil {
+		return nil
+	}
+
+	cache := newCounterVec("keyconjurer_applinks_cache_requests_total", "Requests for app links, by whether they were served from the cache.", "result")
+	cache.Add(float64(m.CacheStats.Hits.Load()), cacheStatusHit)
+	cache.Add(float64(m.CacheStats.Misses.Load()), cacheStatusMiss)
+	cache.Add(float64(m.CacheStats.Bypasses.Load()), cacheStatusBypass)
+	return cache.write(w)
+}
+
+// ServeHTTP serves the metrics for scraping.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Write(w)
+}
+
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) Add(v float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[seriesKey(labelValues)] += v
+}
+
+func (c *counterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, splitSeriesKey(key)), formatFloat(c.values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+func (h *histogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		values := splitSeriesKey(key)
+		labels := append(slices.Clone(h.labels), "le")
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(slices.Clone(values), formatFloat(upper))), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(labels, append(slices.Clone(values), "+Inf")), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values), formatFloat(s.sum))
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seriesKeySeparator separates label values in the keys used to identify each series. It cannot appear in valid UTF-8.
+const seriesKeySeparator = "\xff"
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, seriesKeySeparator)
+}
+
+func splitSeriesKey(key string) []string {
+	return strings.Split(key, seriesKeySeparator)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf(`%s="%s"`, name, labelValueEscaper.Replace(values[i]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := NewMetrics()
+	m.CacheStats = &CacheStats{}
+	m.CacheStats.Hits.Add(3)
+
+	m.ObserveRequest("/v2/applications", 200, 30*time.Millisecond)
+	m.ObserveRequest("/v2/applications", 200, 2*time.Second)
+	m.ObserveRequest("/v2/applications", 502, time.Millisecond)
+	m.ObserveOkta("list_app_links", 300*time.Millisecond, 4)
+
+	var buf bytes.Buffer
+	require.NoError(t, m.Write(&buf))
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE keyconjurer_requests_total counter\n")
+	assert.Contains(t, out, `keyconjurer_requests_total{route="/v2/applications",status="200"} 2`+"\n")
+	assert.Contains(t, out, `keyconjurer_requests_total{route="/v2/applications",status="502"} 1`+"\n")
+	assert.Contains(t, out, `keyconjurer_request_duration_seconds_bucket{route="/v2/applications",le="0.05"} 2`+"\n")
+	assert.Contains(t, out, `keyconjurer_request_duration_seconds_bucket{route="/v2/applications",le="+Inf"} 3`+"\n")
+	assert.Contains(t, out, `keyconjurer_request_duration_seconds_count{route="/v2/applications"} 3`+"\n")
+	assert.Contains(t, out, `keyconjurer_okta_pages_bucket{operation="list_app_links",le="3"} 0`+"\n")
+	assert.Contains(t, out, `keyconjurer_okta_pages_bucket{operation="list_app_links",le="5"} 1`+"\n")
+	assert.Contains(t, out, `keyconjurer_okta_pages_sum{operation="list_app_links"} 4`+"\n")
+	assert.Contains(t, out, `keyconjurer_applinks_cache_requests_total{result="hit"} 3`+"\n")
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("/", 200, time.Second)
+	m.ObserveOkta("list_app_links", time.Second, 1)
+	assert.NoError(t, m.Write(&bytes.Buffer{}))
+}
@@ -1,12 +1,20 @@
 package api
 
 import (
+	"bytes"
 	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"time"
 
 	"github.com/okta/okta-sdk-golang/v2/okta"
+	"github.com/okta/okta-sdk-golang/v2/okta/query"
 )
 
 type Okta struct {
@@ -14,34 +22,274 @@ type Okta struct {
 	Token      string
 	client     *http.Client
 	oktaClient *okta.Client
+	// Metrics, if set, records the time taken by and number of pages fetched for each call to the Okta API.
+	Metrics *Metrics
+	// RateLimits, if set, records the rate limit reported by Okta in each response.
+	RateLimits *OktaRateLimits
 }
 
-func NewOktaService(domain *url.URL, token string) Okta {
-	_, oktaClient, _ := okta.NewClient(
+// NewOktaService returns an Okta service which authenticates with the API token token.
+func NewOktaService(domain *url.URL, token string) (Okta, error) {
+	_, oktaClient, err := okta.NewClient(
 		context.Background(),
 		okta.WithToken(token),
 		okta.WithOrgUrl(domain.String()),
 	)
+	if err != nil {
+		return Okta{}, fmt.Errorf("could not create Okta client: %w", err)
+	}
+
+	return Okta{Domain: domain, Token: token, client: http.DefaultClient, oktaClient: oktaClient}, nil
+}
+
+// DefaultOktaScopes are the scopes requested when authenticating to Okta as an OAuth 2.0 service app.
+var DefaultOktaScopes = []string{"okta.users.read", "okta.apps.read"}
+
+// NewOktaServiceWithPrivateKey returns an Okta service which authenticates as an OAuth 2.0 service app using the client credentials grant and a private key JWT, instead of an API token.
+//
+// privateKey must be a PEM encoded RSA private key in PKCS #1 or PKCS #8 form. Access tokens are requested, cached and refreshed by the Okta SDK.
+func NewOktaServiceWithPrivateKey(domain *url.URL, clientID string, privateKey []byte, scopes []string) (Okta, error) {
+	key, err := pkcs1PrivateKey(privateKey)
+	if err != nil {
+		return Okta{}, err
+	}
+
+	_, oktaClient, err := okta.NewClient(
+		context.Background(),
+		okta.WithOrgUrl(domain.String()),
+		okta.WithAuthorizationMode("PrivateKey"),
+		okta.WithClientId(clientID),
+		okta.WithScopes(scopes),
+		okta.WithPrivateKey(key),
+	)
+	if err != nil {
+		return Okta{}, fmt.Errorf("could not create Okta client: %w", err)
+	}
+
+	return Okta{Domain: domain, client: http.DefaultClient, oktaClient: oktaClient}, nil
+}
+
+// pkcs1PrivateKey returns the RSA private key in the PEM block buf in the PKCS #1 form the Okta SDK requires.
+//
+// Literal \n sequences are treated as newlines so that keys can be supplied in environment variables.
+func pkcs1PrivateKey(buf []byte) (string, error) {
+	block, _ := pem.Decode(bytes.ReplaceAll(buf, []byte(`\n`), []byte("\n")))
+	if block == nil {
+		return "", errors.New("the Okta private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("could not parse the Okta private key: %w", err)
+		}
+		key = k
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("could not parse the Okta private key: %w", err)
+		}
+
+		rsaKey, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("the Okta private key must be an RSA key, not %T", k)
+		}
+		key = rsaKey
+	default:
+		return "", fmt.Errorf("the Okta private key has an unsupported PEM type %q", block.Type)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})), nil
+}
+
+// Ping checks that the Okta domain can be reached by fetching its OpenID Connect discovery document.
+func (o Okta) Ping(ctx context.Context) error {
+	uri := o.Domain.ResolveReference(&url.URL{Path: "/.well-known/openid-configuration"})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return err
+	}
 
-	return Okta{domain, token, http.DefaultClient, oktaClient}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("okta responded with status code %d", resp.StatusCode)
+	}
+	return nil
 }
 
-func (o Okta) ListApplicationsForUser(ctx context.Context, user string) ([]*okta.AppLink, error) {
+// CheckCredentials makes a cheap request to the Okta API to check that Okta can be reached and accepts the configured credentials.
+//
+// An error wrapping ErrUnauthorized is returned if Okta rejects the credentials.
+func (o Okta) CheckCredentials(ctx context.Context) error {
+	_, resp, err := o.oktaClient.User.ListUsers(ctx, query.NewQueryParams(query.WithLimit(1)))
+	o.observeRateLimits(resp)
+	if err == nil {
+		return nil
+	}
+
+	if resp != nil && resp.Response != nil {
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			return fmt.Errorf("%w: %w", ErrUnauthorized, err)
+		case http.StatusForbidden:
+			return fmt.Errorf("the credentials do not grant the okta.users.read scope: %w", err)
+		}
+	}
+
+	return err
+}
+
+// ListApplicationsForUser returns the applications assigned to user, which may be the ID or login of an Okta user.
+func (o Okta) ListApplicationsForUser(ctx context.Context, user string) ([]Application, error) {
+	start, pages := time.Now(), 1
+	defer func() { o.Metrics.ObserveOkta("list_app_links", time.Since(start), pages) }()
+
 	links, resp, err := o.oktaClient.User.ListAppLinks(ctx, user)
+	o.observeRateLimits(resp)
 	if err != nil {
 		return nil, err
 	}
 
 	for resp.HasNextPage() {
+		pages++
 		var next []*okta.AppLink
-		if resp, err = resp.Next(ctx, &next); err != nil {
+		resp, err = resp.Next(ctx, &next)
+		o.observeRateLimits(resp)
+		if err != nil {
 			return nil, err
 		}
 
 		links = append(links, next...)
 	}
 
-	return links, nil
+	apps := make([]Application, len(links))
+	for i, link := range links {
+		apps[i] = Application{ID: link.AppInstanceId, Name: link.Label, Type: link.AppName}
+	}
+
+	return apps, nil
+}
+
+func (o Okta) ListGroupsForUser(ctx context.Context, user string) ([]Group, error) {
+	start, pages := time.Now(), 1
+	defer func() { o.Metrics.ObserveOkta("list_user_groups", time.Since(start), pages) }()
+
+	groups, resp, err := o.oktaClient.User.ListUserGroups(ctx, user)
+	o.observeRateLimits(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	for resp.HasNextPage() {
+		pages++
+		var next []*okta.Group
+		resp, err = resp.Next(ctx, &next)
+		o.observeRateLimits(resp)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, next...)
+	}
+
+	result := make([]Group, len(groups))
+	for i, group := range groups {
+		result[i] = Group{ID: group.Id}
+		if group.Profile != nil {
+			result[i].Name = group.Profile.Name
+		}
+	}
+
+	return result, nil
+}
+
+// LookupUserID returns the ID of the user whose claim has value. Users are found by primary email address for UserClaimEmail, and by ID or login for any other claim.
+//
+// An error wrapping ErrUserNotFound is returned if no single user matches.
+func (o Okta) LookupUserID(ctx context.Context, claim, value string) (string, error) {
+	start := time.Now()
+	defer func() { o.Metrics.ObserveOkta("lookup_user", time.Since(start), 1) }()
+
+	if claim == UserClaimEmail {
+		search := query.NewQueryParams(query.WithSearch(fmt.Sprintf("profile.email eq %q", value)))
+		users, resp, err := o.oktaClient.User.ListUsers(ctx, search)
+		o.observeRateLimits(resp)
+		if err != nil {
+			return "", err
+		}
+
+		switch len(users) {
+		case 0:
+			return "", fmt.Errorf("%w: no user has the email address %s", ErrUserNotFound, value)
+		case 1:
+			return users[0].Id, nil
+		default:
+			return "", fmt.Errorf("%w: %d users have the email address %s", ErrUserNotFound, len(users), value)
+		}
+	}
+
+	user, resp, err := o.oktaClient.User.GetUser(ctx, value)
+	o.observeRateLimits(resp)
+	if resp != nil && resp.Response != nil && resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s", ErrUserNotFound, value)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return user.Id, nil
+}
+
+func (o Okta) observeRateLimits(resp *okta.Response) {
+	if resp != nil && resp.Response != nil {
+		o.RateLimits.Observe(resp.Header)
+	}
+}
+
+// ListRolesForUser returns the names of the roles assigned to the user with the ID userID in the application, whether directly or through a group.
+//
+// Roles are read from the samlRoles attribute of the application user profile, which is used by the AWS Account Federation integration when users may assume several roles, or the role attribute when they may assume one.
+func (o Okta) ListRolesForUser(ctx context.Context, userID, appID string) ([]string, error) {
+	start := time.Now()
+	defer func() { o.Metrics.ObserveOkta("get_application_user", time.Since(start), 1) }()
+
+	appUser, resp, err := o.oktaClient.Application.GetApplicationUser(ctx, appID, userID, nil)
+	o.observeRateLimits(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return rolesFromProfile(appUser.Profile), nil
+}
+
+func rolesFromProfile(profile any) []string {
+	attrs, ok := profile.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var roles []string
+	if values, ok := attrs["samlRoles"].([]any); ok {
+		for _, v := range values {
+			if role, ok := v.(string); ok && role != "" {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	if role, ok := attrs["role"].(string); ok && role != "" && !slices.Contains(roles, role) {
+		roles = append(roles, role)
+	}
+
+	return roles
 }
 
 type Claims struct {
@@ -52,6 +300,8 @@ type Claims struct {
 	Email             string `json:"email"`
 	ZoneInfo          string `json:"zoneinfo"`
 	Locale            string `json:"locale"`
+	// Raw holds every claim, including those without a field above.
+	Raw map[string]any `json:"-"`
 }
 
 var (
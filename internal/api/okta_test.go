@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/okta/okta-sdk-golang/v2/okta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKCS1PrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	pkcs8Bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8Bytes})
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecBytes, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		input []byte
+		err   bool
+	}{
+		{name: "PKCS #1", input: pkcs1},
+		{name: "PKCS #8", input: pkcs8},
+		{name: "escaped newlines", input: []byte(strings.ReplaceAll(string(pkcs8), "\n", `\n`))},
+		{name: "not PEM", input: []byte("hunter2"), err: true},
+		{name: "not RSA", input: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecBytes}), err: true},
+		{name: "public key", input: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("x")}), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pkcs1PrivateKey(tt.input)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, string(pkcs1), got)
+		})
+	}
+}
+
+func TestNewOktaServiceReturnsErrors(t *testing.T) {
+	_, err := NewOktaService(&url.URL{Scheme: "http", Host: "example.okta.com"}, "token")
+	assert.Error(t, err, "the Okta SDK requires HTTPS")
+
+	_, err = NewOktaService(&url.URL{Scheme: "https", Host: "example.okta.com"}, "")
+	assert.Error(t, err, "an empty token should be rejected")
+}
+
+func TestCheckCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		unauthorized bool
+		err          bool
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "rejected", status: http.StatusUnauthorized, unauthorized: true, err: true},
+		{name: "missing scope", status: http.StatusForbidden, err: true},
+		{name: "okta error", status: http.StatusInternalServerError, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/v1/users", r.URL.Path)
+				assert.Equal(t, "1", r.URL.Query().Get("limit"))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					w.Write([]byte("[]"))
+				} else {
+					w.Write([]byte(`{"errorCode":"E0000011","errorSummary":"Invalid token provided"}`))
+				}
+			}))
+			defer srv.Close()
+
+			_, client, err := okta.NewClient(
+				context.Background(),
+				okta.WithOrgUrl(srv.URL),
+				okta.WithToken("token"),
+				okta.WithHttpClient(*srv.Client()),
+				okta.WithCache(false),
+				okta.WithRateLimitMaxRetries(0),
+			)
+			require.NoError(t, err)
+
+			domain, _ := url.Parse(srv.URL)
+			o := Okta{Domain: domain, oktaClient: client}
+			err = o.CheckCredentials(context.Background())
+			if !tt.err {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Equal(t, tt.unauthorized, errors.Is(err, ErrUnauthorized))
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxTrackedUsers is the number of users a RateLimiter keeps buckets for before discarding the buckets of idle users.
+const maxTrackedUsers = 10000
+
+// Limit is the rate, in requests per second, and burst size of a token bucket. A zero Rate means unlimited.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from b if one is available, otherwise returning how long until one will be.
+func (b *tokenBucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	burst := float64(max(limit.Burst, 1))
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// full reports whether b would be full at now, meaning it holds no information worth keeping.
+func (b *tokenBucket) full(limit Limit, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= float64(max(limit.Burst, 1))
+}
+
+// RateLimiter limits the rate of requests served both overall and for each user using token buckets.
+//
+// All methods may be called on a nil *RateLimiter, in which case every request is allowed.
+type RateLimiter struct {
+	Global, PerUser Limit
+	now             func() time.Time
+
+	mu     sync.Mutex
+	global *tokenBucket
+	users  map[string]*tokenBucket
+}
+
+func NewRateLimiter(global, perUser Limit) *RateLimiter {
+	return &RateLimiter{
+		Global:  global,
+		PerUser: perUser,
+		now:     time.Now,
+		users:   make(map[string]*tokenBucket),
+	}
+}
+
+func (l *RateLimiter) newBucket(limit Limit, now time.Time) *tokenBucket {
+	return &tokenBucket{tokens: float64(max(limit.Burst, 1)), last: now}
+}
+
+// AllowGlobal reports whether another request may be served, or how long the client should wait before retrying.
+func (l *RateLimiter) AllowGlobal() (bool, time.Duration) {
+	if l == nil || l.Global.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.global == nil {
+		l.global = l.newBucket(l.Global, now)
+	}
+	return l.global.take(l.Global, now)
+}
+
+// AllowUser reports whether another request may be served for user, or how long the client should wait before retrying.
+func (l *RateLimiter) AllowUser(user string) (bool, time.Duration) {
+	if l == nil || l.PerUser.Rate <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.users[user]
+	if !ok {
+		if len(l.users) >= maxTrackedUsers {
+			l.pruneLocked(now)
+		}
+		bucket = l.newBucket(l.PerUser, now)
+		l.users[user] = bucket
+	}
+	return bucket.take(l.PerUser, now)
+}
+
+// pruneLocked discards the buckets of users who have not made a request recently enough to be limited.
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	for user, bucket := range l.users {
+		if bucket.full(l.PerUser, now) {
+			delete(l.users, user)
+		}
+	}
+}
+
+// OktaRateLimits tracks the rate limit Okta reports through the X-Rate-Limit-* headers so that requests can stop being made before Okta begins rejecting them.
+//
+// All methods may be called on a nil *OktaRateLimits, in which case no backoff is ever required.
+type OktaRateLimits struct {
+	// Reserve is the fraction of the limit which should be left unused. Once fewer requests than this remain, Backoff reports that requests should wait until the limit resets.
+	Reserve float64
+	now     func() time.Time
+
+	mu        sync.Mutex
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+func NewOktaRateLimits(reserve float64) *OktaRateLimits {
+	return &OktaRateLimits{Reserve: reserve, now: time.Now}
+}
+
+// Observe records the rate limit headers from an Okta API response.
+func (o *OktaRateLimits) Observe(header http.Header) {
+	if o == nil {
+		return
+	}
+
+	limit, err1 := strconv.Atoi(header.Get("X-Rate-Limit-Limit"))
+	remaining, err2 := strconv.Atoi(header.Get("X-Rate-Limit-Remaining"))
+	reset, err3 := strconv.ParseInt(header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.limit, o.remaining, o.reset = limit, remaining, time.Unix(reset, 0)
+}
+
+// Backoff returns how long to wait before making another request to Okta, or zero if a request may be made now.
+func (o *OktaRateLimits) Backoff() time.Duration {
+	if o == nil {
+		return 0
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := o.now()
+	if o.limit == 0 || !now.Before(o.reset) {
+		return 0
+	}
+
+	if float64(o.remaining) > float64(o.limit)*o.Reserve {
+		return 0
+	}
+
+	return o.reset.Sub(now)
+}
+
+// OktaBackoffError is returned instead of making a request to Okta when the Okta rate limit is close to being exhausted.
+type OktaBackoffError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OktaBackoffError) Error() string {
+	return fmt.Sprintf("close to the Okta rate limit, backing off for %s", e.RetryAfter)
+}
+
+// serveRateLimited writes a 429 Too Many Requests response telling the client to retry after retryAfter.
+func serveRateLimited(w *Response, retryAfter time.Duration) {
+	ServeJSONError(w, http.StatusTooManyRequests, "too many requests")
+	w.Headers["Retry-After"] = strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterAllowUser(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(Limit{}, Limit{Rate: 1, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.AllowUser("alice")
+		require.True(t, ok, "request %d should be within the burst", i)
+	}
+
+	ok, retryAfter := l.AllowUser("alice")
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, retryAfter)
+
+	ok, _ = l.AllowUser("bob")
+	assert.True(t, ok, "each user should have their own bucket")
+
+	now = now.Add(time.Second)
+	ok, _ = l.AllowUser("alice")
+	assert.True(t, ok, "a token should have been added after a second")
+}
+
+func TestRateLimiterAllowGlobal(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(Limit{Rate: 2, Burst: 1}, Limit{})
+	l.now = func() time.Time { return now }
+
+	ok, _ := l.AllowGlobal()
+	require.True(t, ok)
+	ok, retryAfter := l.AllowGlobal()
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	ok, _ = l.AllowUser("alice")
+	assert.True(t, ok, "a zero per-user rate should not limit users")
+}
+
+func TestRateLimiterNil(t *testing.T) {
+	var l *RateLimiter
+	ok, _ := l.AllowGlobal()
+	assert.True(t, ok)
+	ok, _ = l.AllowUser("alice")
+	assert.True(t, ok)
+}
+
+func TestRateLimiterPrunesIdleUsers(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRateLimiter(Limit{}, Limit{Rate: 1, Burst: 1})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < maxTrackedUsers; i++ {
+		l.AllowUser(strconv.Itoa(i))
+	}
+
+	now = now.Add(time.Minute)
+	l.AllowUser("alice")
+	assert.Len(t, l.users, 1, "idle users should have been pruned")
+}
+
+func oktaRateLimitHeaders(limit, remaining int, reset time.Time) http.Header {
+	header := http.Header{}
+	header.Set("X-Rate-Limit-Limit", strconv.Itoa(limit))
+	header.Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+	header.Set("X-Rate-Limit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return header
+}
+
+func TestOktaRateLimitsBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	o := NewOktaRateLimits(0.1)
+	o.now = func() time.Time { return now }
+	assert.Zero(t, o.Backoff(), "no backoff is needed before any headers have been observed")
+
+	o.Observe(oktaRateLimitHeaders(100, 50, now.Add(30*time.Second)))
+	assert.Zero(t, o.Backoff())
+
+	o.Observe(oktaRateLimitHeaders(100, 10, now.Add(30*time.Second)))
+	assert.Equal(t, 30*time.Second, o.Backoff())
+
+	o.Observe(http.Header{})
+	assert.Equal(t, 30*time.Second, o.Backoff(), "responses without rate limit headers should be ignored")
+
+	now = now.Add(30 * time.Second)
+	assert.Zero(t, o.Backoff(), "no backoff is needed once the limit has reset")
+}
+
+func TestListApplicationsBacksOffFromOkta(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	limits := NewOktaRateLimits(0.1)
+	limits.Observe(oktaRateLimitHeaders(100, 0, now.Add(time.Minute)))
+
+	directory := &countingDirectory{apps: []Application{{Type: AppNameAWS, Name: "AWS - one"}}}
+	h := ServeUserApplicationsHandler{
+		Directory:      directory,
+		Cache:          NewLRUCache(10),
+		CacheTTL:       time.Minute,
+		OktaRateLimits: limits,
+	}
+
+	_, _, _, err := h.listApplications(ctx, "user", false, nil)
+	var backoffErr *OktaBackoffError
+	require.True(t, errors.As(err, &backoffErr))
+	assert.Greater(t, backoffErr.RetryAfter, time.Duration(0))
+	assert.Equal(t, 0, directory.calls)
+
+	require.NoError(t, h.Cache.Set(ctx, "user", CacheEntry{Applications: directory.apps, StoredAt: now, Expires: now.Add(time.Minute)}))
+	apps, status, _, err := h.listApplications(ctx, "user", true, nil)
+	require.NoError(t, err)
+	assert.Equal(t, cacheStatusHit, status, "a refresh should be served from the cache while backing off")
+	assert.Len(t, apps, 1)
+	assert.Equal(t, 0, directory.calls)
+}
+
+func TestServeRateLimited(t *testing.T) {
+	var w Response
+	serveRateLimited(&w, 1500*time.Millisecond)
+	assert.Equal(t, http.StatusTooManyRequests, w.StatusCode)
+	assert.Equal(t, "2", w.Headers["Retry-After"])
+	assert.Equal(t, auditOutcomeRateLimited, auditOutcome(w.StatusCode))
+}
+
+func TestServeUserApplicationsHandlerChargesGlobalLimitOncePerRequest(t *testing.T) {
+	const burst = 3
+	h := ServeUserApplicationsHandler{
+		Idp:         newFakeOIDCProvider(t),
+		Directory:   &fakeDirectory{apps: []Application{{ID: "0oa1", Type: AppNameAWS, Name: "AWS - one"}}},
+		RateLimiter: NewRateLimiter(Limit{Rate: 0.001, Burst: burst}, Limit{Rate: 1000, Burst: 1000}),
+	}
+
+	var served int
+	for range burst + 2 {
+		w := h.Handle(context.Background(), Request{Method: http.MethodGet, Headers: map[string]string{"authorization": "Bearer valid"}})
+		if statusCode(w) == http.StatusOK {
+			served++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, statusCode(w))
+		}
+	}
+
+	assert.Equal(t, burst, served, "exactly the global burst should be served, whatever the limit of the user")
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Router is a Handler which sends each request to the Handler registered for its method and path.
+type Router struct {
+	routes []route
+}
+
+type route struct {
+	methods  []string
+	pattern  string
+	segments []string
+	handler  Handler
+}
+
+// Route registers h to serve requests with one of methods to pattern.
+//
+// Segments of pattern written as {name} match any single path segment, and the unescaped value is made available to h through Request.PathParams.
+func (rt *Router) Route(methods []string, pattern string, h Handler) {
+	rt.routes = append(rt.routes, route{
+		methods:  methods,
+		pattern:  pattern,
+		segments: splitPath(pattern),
+		handler:  h,
+	})
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// match reports whether path matches the route, returning the values of any parameters.
+func (r route) match(path []string) (map[string]string, bool) {
+	if len(path) != len(r.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			// Segments are split before unescaping so that an escaped slash, which clients send in IDs they cannot trust, stays within the parameter.
+			value, err := url.PathUnescape(path[i])
+			if err != nil {
+				return nil, false
+			}
+
+			params[segment[1:len(segment)-1]] = value
+			continue
+		}
+
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+func (rt *Router) Handle(ctx context.Context, r Request) (w Response) {
+	path := splitPath(r.Path)
+	methodNotAllowed := false
+	for _, route := range rt.routes {
+		params, ok := route.match(path)
+		if !ok {
+			continue
+		}
+
+		if !slices.Contains(route.methods, r.Method) {
+			methodNotAllowed = true
+			continue
+		}
+
+		r.PathParams = params
+		if event, ok := ctx.Value(auditEventKey{}).(*AuditEvent); ok {
+			event.Route = route.pattern
+		}
+		return route.handler.Handle(ctx, r)
+	}
+
+	if methodNotAllowed {
+		ServeJSONError(&w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	ServeJSONError(&w, http.StatusNotFound, "not found")
+	return
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	var rt Router
+	rt.Route([]string{http.MethodPost}, "/v2/applications", HandlerFunc(func(ctx context.Context, r Request) (w Response) {
+		w.Body = "applications"
+		return
+	}))
+	rt.Route([]string{http.MethodGet}, "/v2/applications/{id}/roles", HandlerFunc(func(ctx context.Context, r Request) (w Response) {
+		w.Body = "roles for " + r.PathParams["id"]
+		return
+	}))
+
+	tests := []struct {
+		method, path string
+		wantStatus   int
+		wantBody     string
+	}{
+		{http.MethodPost, "/v2/applications", 0, "applications"},
+		{http.MethodPost, "/v2/applications/", 0, "applications"},
+		{http.MethodGet, "/v2/applications/0oa1/roles", 0, "roles for 0oa1"},
+		{http.MethodGet, "/v2/applications/0oa%2F1%20a/roles", 0, "roles for 0oa/1 a"},
+		{http.MethodGet, "/v2/applications/0oa%zz/roles", http.StatusNotFound, `{"error":"not found"}`},
+		{http.MethodGet, "/v2/applications", http.StatusMethodNotAllowed, `{"error":"method not allowed"}`},
+		{http.MethodGet, "/v2/applications/0oa1", http.StatusNotFound, `{"error":"not found"}`},
+		{http.MethodGet, "/v1/applications", http.StatusNotFound, `{"error":"not found"}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			w := rt.Handle(context.Background(), Request{Method: tc.method, Path: tc.path})
+			assert.Equal(t, tc.wantStatus, w.StatusCode)
+			assert.Equal(t, tc.wantBody, w.Body)
+		})
+	}
+}
+
+func TestRolesFromProfile(t *testing.T) {
+	assert.Equal(t, []string{"Admin", "ReadOnly"}, rolesFromProfile(map[string]any{"samlRoles": []any{"Admin", "ReadOnly"}}))
+	assert.Equal(t, []string{"Admin"}, rolesFromProfile(map[string]any{"role": "Admin"}))
+	assert.Equal(t, []string{"Admin", "ReadOnly"}, rolesFromProfile(map[string]any{"samlRoles": []any{"Admin"}, "role": "ReadOnly"}))
+	assert.Nil(t, rolesFromProfile(map[string]any{"email": "user@example.com"}))
+	assert.Nil(t, rolesFromProfile(nil))
+}
@@ -3,92 +3,514 @@ package api
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"log/slog"
+	"maps"
 
-	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/coreos/go-oidc"
-	"github.com/okta/okta-sdk-golang/v2/okta"
+	"golang.org/x/oauth2"
 )
 
 type Application struct {
 	ID   string `json:"@id"`
 	Name string `json:"name"`
+	// Type identifies the kind of application, such as amazon_aws for applications created from the Okta AWS Account Federation integration.
+	Type string `json:"type,omitempty"`
+	// Roles lists the names of the roles the user may assume in the application. It is only present when requested.
+	Roles []string `json:"roles,omitempty"`
 }
 
-type OktaService interface {
-	ListApplicationsForUser(ctx context.Context, user string) ([]*okta.AppLink, error)
+type ServeUserApplicationsHandler struct {
+	Directory ApplicationDirectory
+	Idp       *oidc.Provider
+	// UserClaim is the claim which identifies the user making a request: UserClaimPreferredUsername, UserClaimSub, UserClaimEmail or any other claim whose value identifies a user in Directory.
+	// If empty, UserClaimPreferredUsername is used.
+	UserClaim string
+	// TokenVerifier, if set, verifies bearer tokens which are JWTs locally instead of asking the userinfo endpoint of Idp about them.
+	TokenVerifier *TokenVerifier
+	// Filter decides which applications are served. If nil, DefaultApplicationFilter is used.
+	Filter *ApplicationFilter
+	// Cache, if set, stores the applications of each user for CacheTTL.
+	Cache    ApplicationCache
+	CacheTTL time.Duration
+	// CacheStats, if set, records whether requests were served from Cache.
+	CacheStats *CacheStats
+	// RateLimiter, if set, limits how often requests are served.
+	RateLimiter *RateLimiter
+	// OktaRateLimits, if set, is used to stop making requests to Okta when close to the Okta rate limit.
+	OktaRateLimits *OktaRateLimits
 }
 
-type ServeUserApplicationsHandler struct {
-	Okta OktaService
-	Idp  *oidc.Provider
+// listApplications returns the applications of user from the cache if possible, falling back to the directory, along with a description of how the cache was used and the entry that was served.
+// If the filter requires groups, the groups of user are fetched and cached alongside their applications and are present in the entry.
+//
+// The cache is bypassed and refreshed when refresh is true.
+func (s ServeUserApplicationsHandler) listApplications(ctx context.Context, user string, refresh bool, requestAttrs []any) ([]Application, string, CacheEntry, error) {
+	backoff := s.OktaRateLimits.Backoff()
+	if s.Cache == nil {
+		if backoff > 0 {
+			return nil, "", CacheEntry{}, &OktaBackoffError{RetryAfter: backoff}
+		}
+
+		entry, err := s.fetchApplications(ctx, user)
+		return entry.Applications, "", entry, err
+	}
+
+	status := cacheStatusBypass
+	// Refreshing is not possible while backing off from Okta, but a cached entry is better than nothing.
+	if !refresh || backoff > 0 {
+		entry, ok, err := s.Cache.Get(ctx, user)
+		if err != nil {
+			slog.Warn("failed to read from application cache", append(requestAttrs, slog.String("error", err.Error()))...)
+		}
+
+		// Entries stored before groups were required cannot be used to filter applications.
+		if ok && (len(s.filter().RequiredGroups) == 0 || entry.Groups != nil) {
+			s.recordCacheStatus(cacheStatusHit)
+			return entry.Applications, cacheStatusHit, entry, nil
+		}
+
+		if !refresh {
+			status = cacheStatusMiss
+		}
+	}
+
+	s.recordCacheStatus(status)
+	if backoff > 0 {
+		return nil, status, CacheEntry{}, &OktaBackoffError{RetryAfter: backoff}
+	}
+
+	entry, err := s.fetchApplications(ctx, user)
+	if err != nil {
+		return nil, status, CacheEntry{}, err
+	}
+
+	now := time.Now()
+	entry.StoredAt, entry.Expires = now, now.Add(s.CacheTTL)
+	if err := s.Cache.Set(ctx, user, entry); err != nil {
+		slog.Warn("failed to write to application cache", append(requestAttrs, slog.String("error", err.Error()))...)
+	}
+
+	return entry.Applications, status, entry, nil
 }
 
-func (s ServeUserApplicationsHandler) Handle(ctx context.Context, r events.ALBTargetGroupRequest) (w events.ALBTargetGroupResponse, err error) {
-	requestAttrs := RequestAttrs(r)
-	ts, ok := requestTokenSource(r)
+// fetchApplications fetches the applications of user from the directory, along with the groups of user if the filter requires them.
+func (s ServeUserApplicationsHandler) fetchApplications(ctx context.Context, user string) (CacheEntry, error) {
+	apps, err := s.Directory.ListApplicationsForUser(ctx, user)
+	if err != nil {
+		return CacheEntry{}, err
+	}
+
+	entry := CacheEntry{Applications: apps}
+	if len(s.filter().RequiredGroups) == 0 {
+		return entry, nil
+	}
+
+	// Paging through the applications of the user may have used up what remained of the Okta rate limit.
+	if backoff := s.OktaRateLimits.Backoff(); backoff > 0 {
+		return CacheEntry{}, &OktaBackoffError{RetryAfter: backoff}
+	}
+
+	groups, err := s.Directory.ListGroupsForUser(ctx, user)
+	if err != nil {
+		return CacheEntry{}, fmt.Errorf("failed to fetch groups: %w", err)
+	}
+
+	entry.Groups = append([]Group{}, groups...)
+	return entry, nil
+}
+
+func (s ServeUserApplicationsHandler) filter() ApplicationFilter {
+	if s.Filter != nil {
+		return *s.Filter
+	}
+	return DefaultApplicationFilter
+}
+
+// listRoles returns the roles of user in the application appID, from entry if they have been fetched before.
+//
+// Roles are otherwise fetched from the directory, unless requests to Okta should be backed off from, and are added to entry and stored in the cache if entry came from it.
+func (s ServeUserApplicationsHandler) listRoles(ctx context.Context, user string, entry *CacheEntry, appID string) ([]string, error) {
+	if roles, ok := entry.Roles[appID]; ok {
+		return roles, nil
+	}
+
+	if entry.UserID == "" {
+		id, err := s.lookupUserID(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		entry.UserID = id
+	}
+
+	if backoff := s.OktaRateLimits.Backoff(); backoff > 0 {
+		return nil, &OktaBackoffError{RetryAfter: backoff}
+	}
+
+	roles, err := s.Directory.ListRolesForUser(ctx, entry.UserID, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The map may be shared with the copy of the entry held by the cache, so it is never modified in place.
+	entry.Roles = maps.Clone(entry.Roles)
+	if entry.Roles == nil {
+		entry.Roles = make(map[string][]string)
+	}
+	entry.Roles[appID] = roles
+
+	if s.Cache != nil && !entry.Expires.IsZero() {
+		if err := s.Cache.Set(ctx, user, *entry); err != nil {
+			slog.Warn("failed to write to application cache", slog.String("username", user), slog.String("error", err.Error()))
+		}
+	}
+
+	return roles, nil
+}
+
+// lookupUserID returns the ID of user, which is the value returned by identifyUser.
+// Only the preferred_username claim identifies users by something other than their ID.
+func (s ServeUserApplicationsHandler) lookupUserID(ctx context.Context, user string) (string, error) {
+	if s.userClaim() != UserClaimPreferredUsername {
+		return user, nil
+	}
+
+	if backoff := s.OktaRateLimits.Backoff(); backoff > 0 {
+		return "", &OktaBackoffError{RetryAfter: backoff}
+	}
+
+	// Okta looks up users by login for any claim other than email.
+	return s.Directory.LookupUserID(ctx, UserClaimSub, user)
+}
+
+// allow applies the rate limit for user, or the global rate limit if user is empty, writing a 429 Too Many Requests response to w if the request should not be served.
+func (s ServeUserApplicationsHandler) allow(ctx context.Context, w *Response, user string, requestAttrs []any) bool {
+	// Each request is charged against the global limit once, before the user is known, and against the limit of the user once they are.
+	var ok bool
+	var retryAfter time.Duration
+	if user == "" {
+		ok, retryAfter = s.RateLimiter.AllowGlobal()
+	} else {
+		ok, retryAfter = s.RateLimiter.AllowUser(user)
+	}
+
+	if ok {
+		return true
+	}
+
+	auditEvent(ctx).Error = "rate limited"
+	slog.Warn("rate limited request", append(requestAttrs, slog.Duration("retry_after", retryAfter))...)
+	serveRateLimited(w, retryAfter)
+	return false
+}
+
+// serveUpstreamError writes a response for an error returned when talking to the directory.
+func serveUpstreamError(ctx context.Context, w *Response, msg string, err error, requestAttrs []any) {
+	auditEvent(ctx).Error = err.Error()
+	requestAttrs = append(requestAttrs, slog.String("error", err.Error()))
+
+	var backoffErr *OktaBackoffError
+	if errors.As(err, &backoffErr) {
+		slog.Warn("backing off from Okta", requestAttrs...)
+		serveRateLimited(w, backoffErr.RetryAfter)
+		return
+	}
+
+	slog.Error(msg, requestAttrs...)
+	ServeJSONError(w, http.StatusBadGateway, "upstream error")
+}
+
+func (s ServeUserApplicationsHandler) recordCacheStatus(status string) {
+	if s.CacheStats == nil {
+		return
+	}
+
+	switch status {
+	case cacheStatusHit:
+		s.CacheStats.Hits.Add(1)
+	case cacheStatusMiss:
+		s.CacheStats.Misses.Add(1)
+	case cacheStatusBypass:
+		s.CacheStats.Bypasses.Add(1)
+	}
+}
+
+// setCacheHeaders tells clients and intermediate caches how long the response may be reused for. Responses are specific to a user and so may only be stored by the client.
+func setCacheHeaders(w *Response, status string, entry CacheEntry) {
+	if w.Headers == nil {
+		w.Headers = make(map[string]string)
+	}
+
+	if status == "" {
+		w.Headers["Cache-Control"] = "private, no-store"
+		return
+	}
+
+	now := time.Now()
+	maxAge := int(entry.Expires.Sub(now) / time.Second)
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	w.Headers["Cache-Control"] = fmt.Sprintf("private, max-age=%d", maxAge)
+	w.Headers["Age"] = strconv.Itoa(int(now.Sub(entry.StoredAt) / time.Second))
+	w.Headers["X-Cache"] = status
+}
+
+// authenticate identifies the user making r, writing an error to w if they cannot be identified.
+func (s ServeUserApplicationsHandler) authenticate(ctx context.Context, r Request, w *Response, requestAttrs []any) (string, bool) {
+	event := auditEvent(ctx)
+	raw, ok := requestBearerToken(r)
 	if !ok {
+		event.Error = "no bearer token present"
 		slog.Error("no bearer token present", requestAttrs...)
-		ServeJSONError(&w, http.StatusUnauthorized, "unauthorized")
-		return
+		ServeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return "", false
+	}
+
+	claims, ok := s.verifyToken(ctx, raw, w, requestAttrs)
+	if !ok {
+		return "", false
+	}
+
+	user, err := s.identifyUser(ctx, claims)
+	if errors.Is(err, ErrUserNotFound) {
+		event.Error = err.Error()
+		slog.Warn("could not identify user", append(requestAttrs, slog.String("error", err.Error()))...)
+		ServeJSONError(w, http.StatusForbidden, "forbidden")
+		return "", false
 	}
 
-	info, err := s.Idp.UserInfo(ctx, ts)
 	if err != nil {
-		if errors.Is(err, ErrBadRequest) {
-			slog.Error("okta indicated the request was poorly formed", requestAttrs...)
-			ServeJSONError(&w, http.StatusInternalServerError, "internal error when talking to the Okta API")
-			return
+		serveUpstreamError(ctx, w, "failed to look up user", err, requestAttrs)
+		return "", false
+	}
+
+	event.User = user
+	return user, true
+}
+
+// verifyToken returns the claims of the bearer token raw, writing an error to w if the token is not accepted.
+func (s ServeUserApplicationsHandler) verifyToken(ctx context.Context, raw string, w *Response, requestAttrs []any) (Claims, bool) {
+	event := auditEvent(ctx)
+	if s.TokenVerifier != nil {
+		claims, err := s.TokenVerifier.Verify(ctx, raw)
+		switch {
+		case err == nil && claims.Value(s.userClaim()) != "":
+			return claims, true
+		case err == nil:
+			slog.Debug("token has no "+s.userClaim()+" claim, falling back to the userinfo endpoint", requestAttrs...)
+		case errors.Is(err, ErrOpaqueToken):
+			slog.Debug("token is opaque, falling back to the userinfo endpoint", requestAttrs...)
+		default:
+			event.Error = err.Error()
+			slog.Error("rejected token", append(requestAttrs, slog.String("error", err.Error()))...)
+			ServeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return Claims{}, false
 		}
+	}
 
+	info, err := s.userInfo(ctx, raw)
+	if err != nil {
+		event.Error = err.Error()
 		requestAttrs = append(requestAttrs, slog.String("error", err.Error()))
-		slog.Error("okta rejected id token", requestAttrs...)
-		ServeJSONError(&w, http.StatusForbidden, "unauthorized")
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			slog.Error("okta rejected token", requestAttrs...)
+			ServeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		case errors.Is(err, ErrBadRequest):
+			slog.Error("okta indicated the request was poorly formed", requestAttrs...)
+			ServeJSONError(w, http.StatusInternalServerError, "internal error when talking to the Okta API")
+		default:
+			slog.Error("failed to call the Okta userinfo endpoint", requestAttrs...)
+			ServeJSONError(w, http.StatusBadGateway, "upstream error")
+		}
+		return Claims{}, false
+	}
+
+	claims, err := decodeClaims(info.Claims)
+	if err != nil {
+		event.Error = err.Error()
+		slog.Error("failed to parse claims from Okta userinfo endpoint", append(requestAttrs, slog.String("error", err.Error()))...)
+		ServeJSONError(w, http.StatusInternalServerError, "internal error when talking to the Okta API")
+		return Claims{}, false
+	}
+
+	return claims, true
+}
+
+// userInfo calls the userinfo endpoint of the identity provider with the bearer token raw.
+//
+// Errors caused by the token being rejected wrap ErrUnauthorized, and errors caused by the request being malformed wrap ErrBadRequest.
+func (s ServeUserApplicationsHandler) userInfo(ctx context.Context, raw string) (*oidc.UserInfo, error) {
+	info, err := s.Idp.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: raw}))
+	if err == nil {
+		return info, nil
+	}
+
+	// go-oidc only reports the status code of unsuccessful responses at the start of the error message.
+	msg := err.Error()
+	switch {
+	case strings.HasPrefix(msg, "400 "):
+		return nil, fmt.Errorf("%w: %w", ErrBadRequest, err)
+	case strings.HasPrefix(msg, "401 "), strings.HasPrefix(msg, "403 "):
+		return nil, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	return nil, err
+}
+
+// allowedApplications returns the applications of user which pass the filter.
+func (s ServeUserApplicationsHandler) allowedApplications(ctx context.Context, user string, refresh bool, requestAttrs []any) ([]Application, string, CacheEntry, error) {
+	apps, cacheStatus, cacheEntry, err := s.listApplications(ctx, user, refresh, requestAttrs)
+	if err != nil {
+		return nil, cacheStatus, cacheEntry, err
+	}
+
+	filter := s.filter()
+	if !filter.AllowGroups(cacheEntry.Groups) {
+		slog.Info("user is not a member of any required group", requestAttrs...)
+		return nil, cacheStatus, cacheEntry, nil
+	}
+
+	var allowed []Application
+	for _, app := range apps {
+		if filter.Allow(app) {
+			allowed = append(allowed, app)
+		}
+	}
+
+	return allowed, cacheStatus, cacheEntry, nil
+}
+
+// Handle serves the applications the user may access.
+//
+// If the roles query parameter is true, the roles the user may assume in each application are included. This requires an additional request to the directory for each application whose roles are not cached.
+func (s ServeUserApplicationsHandler) Handle(ctx context.Context, r Request) (w Response) {
+	requestAttrs := RequestAttrs(r)
+	if !s.allow(ctx, &w, "", requestAttrs) {
+		return
+	}
+
+	user, ok := s.authenticate(ctx, r, &w, requestAttrs)
+	if !ok {
 		return
 	}
 
-	var claims Claims
-	if err := info.Claims(&claims); err != nil {
-		slog.Error("failed to parse claims from Okta userinfo endpoint", requestAttrs...)
-		ServeJSONError(&w, http.StatusInternalServerError, "internal error when talking to the Okta API")
+	requestAttrs = append(requestAttrs, slog.String("username", user))
+	if !s.allow(ctx, &w, user, requestAttrs) {
+		return
+	}
+
+	applications, cacheStatus, cacheEntry, err := s.allowedApplications(ctx, user, r.Query["refresh"] == "true", requestAttrs)
+	if cacheStatus != "" {
+		requestAttrs = append(requestAttrs, slog.String("cache", cacheStatus))
+	}
+
+	if s.CacheStats != nil {
+		requestAttrs = append(requestAttrs, slog.Float64("cache_hit_rate", s.CacheStats.HitRate()))
 	}
 
-	requestAttrs = append(requestAttrs, slog.String("username", claims.PreferredUsername))
-	applications, err := s.Okta.ListApplicationsForUser(ctx, claims.PreferredUsername)
 	if err != nil {
-		requestAttrs = append(requestAttrs, slog.String("error", err.Error()))
-		slog.Error("failed to fetch applications", requestAttrs...)
-		ServeJSONError(&w, http.StatusBadGateway, "upstream error")
+		serveUpstreamError(ctx, &w, "failed to fetch applications", err, requestAttrs)
 		return
 	}
 
+	includeRoles := r.Query["roles"] == "true"
 	var accounts []Application
 	for _, app := range applications {
-		if app.AppName == "amazon_aws" {
-			accounts = append(accounts, Application{
-				ID:   app.AppInstanceId,
-				Name: app.Label,
-			})
+		account := Application{ID: app.ID, Name: app.Name, Type: app.Type}
+		if includeRoles {
+			if account.Roles, err = s.listRoles(ctx, user, &cacheEntry, app.ID); err != nil {
+				serveUpstreamError(ctx, &w, "failed to fetch roles", err, append(requestAttrs, slog.String("application_id", app.ID)))
+				return
+			}
 		}
+
+		accounts = append(accounts, account)
 	}
 
+	auditEvent(ctx).ApplicationCount = len(accounts)
 	requestAttrs = append(requestAttrs, slog.Int("application_count", len(accounts)))
 	slog.Info("served applications", requestAttrs...)
 	ServeJSON(&w, accounts)
+	setCacheHeaders(&w, cacheStatus, cacheEntry)
+	return
+}
+
+// HandleRoles serves the roles the user may assume in the application given by the id path parameter.
+func (s ServeUserApplicationsHandler) HandleRoles(ctx context.Context, r Request) (w Response) {
+	requestAttrs := RequestAttrs(r)
+	if !s.allow(ctx, &w, "", requestAttrs) {
+		return
+	}
+
+	user, ok := s.authenticate(ctx, r, &w, requestAttrs)
+	if !ok {
+		return
+	}
+
+	id := r.PathParams["id"]
+	event := auditEvent(ctx)
+	event.ApplicationID = id
+	requestAttrs = append(requestAttrs, slog.String("username", user), slog.String("application_id", id))
+	if !s.allow(ctx, &w, user, requestAttrs) {
+		return
+	}
+
+	applications, _, cacheEntry, err := s.allowedApplications(ctx, user, false, requestAttrs)
+	if err != nil {
+		serveUpstreamError(ctx, &w, "failed to fetch applications", err, requestAttrs)
+		return
+	}
+
+	idx := slices.IndexFunc(applications, func(app Application) bool { return app.ID == id })
+	if idx == -1 {
+		// Applications the user cannot access are indistinguishable from applications that do not exist so that IDs cannot be enumerated.
+		slog.Info("user requested roles for an application they cannot access", requestAttrs...)
+		ServeJSONError(&w, http.StatusNotFound, "application not found")
+		return
+	}
+
+	app := applications[idx]
+	roles, err := s.listRoles(ctx, user, &cacheEntry, id)
+	if err != nil {
+		serveUpstreamError(ctx, &w, "failed to fetch roles", err, requestAttrs)
+		return
+	}
+
+	event.ApplicationCount = 1
+	requestAttrs = append(requestAttrs, slog.Int("role_count", len(roles)))
+	slog.Info("served roles", requestAttrs...)
+	ServeJSON(&w, Application{ID: app.ID, Name: app.Name, Type: app.Type, Roles: roles})
 	return
 }
 
+// NewRouter returns a Router which serves the account server API using s.
+func NewRouter(s ServeUserApplicationsHandler) *Router {
+	var rt Router
+	methods := []string{http.MethodGet, http.MethodPost}
+	rt.Route(methods, "/v2/applications", s)
+	rt.Route(methods, "/v2/applications/{id}/roles", HandlerFunc(s.HandleRoles))
+	return &rt
+}
+
+// Handler returns a Lambda handler which serves s behind an Application Load Balancer.
 func (s ServeUserApplicationsHandler) Handler() lambda.Handler {
-	return lambda.NewHandler(s.Handle)
+	return ALBHandler(NewRouter(s))
 }
 
-func ServeUserApplications(okta OktaService, idp *oidc.Provider) lambda.Handler {
+func ServeUserApplications(directory ApplicationDirectory, idp *oidc.Provider) lambda.Handler {
 	h := ServeUserApplicationsHandler{
-		Okta: okta,
-		Idp:  idp,
+		Directory: directory,
+		Idp:       idp,
 	}
 
 	return h.Handler()
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeOIDCProvider returns a provider whose userinfo endpoint responds according to the bearer token:
+//
+//   - valid: the claims of user@example.com
+//   - no-username: claims without preferred_username
+//   - bad-claims: claims of the wrong type
+//   - malformed: 400 Bad Request
+//   - expired: 401 Unauthorized
+//   - broken: 500 Internal Server Error
+func newFakeOIDCProvider(t *testing.T) *oidc.Provider {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 srv.URL,
+			"authorization_endpoint": srv.URL + "/authorize",
+			"token_endpoint":         srv.URL + "/token",
+			"jwks_uri":               srv.URL + "/keys",
+			"userinfo_endpoint":      srv.URL + "/userinfo",
+		})
+	})
+
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		case "valid":
+			w.Write([]byte(`{"sub":"00u1","preferred_username":"user@example.com","email":"user@example.com"}`))
+		case "no-username":
+			w.Write([]byte(`{"sub":"00u1"}`))
+		case "bad-claims":
+			w.Write([]byte(`{"sub":"00u1","preferred_username":5}`))
+		case "malformed":
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+		case "expired":
+			http.Error(w, "invalid_token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "oops", http.StatusInternalServerError)
+		}
+	})
+
+	idp, err := oidc.NewProvider(context.Background(), srv.URL)
+	require.NoError(t, err)
+	return idp
+}
+
+type fakeDirectory struct {
+	apps     []Application
+	roles    []string
+	users    map[string]string
+	err      error
+	rolesErr error
+	// requestedFor records the user given to each call.
+	requestedFor []string
+}
+
+func (o *fakeDirectory) ListApplicationsForUser(ctx context.Context, user string) ([]Application, error) {
+	o.requestedFor = append(o.requestedFor, user)
+	return o.apps, o.err
+}
+
+func (o *fakeDirectory) ListGroupsForUser(ctx context.Context, user string) ([]Group, error) {
+	o.requestedFor = append(o.requestedFor, user)
+	return nil, o.err
+}
+
+func (o *fakeDirectory) ListRolesForUser(ctx context.Context, user, appID string) ([]string, error) {
+	o.requestedFor = append(o.requestedFor, user)
+	return o.roles, o.rolesErr
+}
+
+func (o *fakeDirectory) LookupUserID(ctx context.Context, claim, value string) (string, error) {
+	id, ok := o.users[value]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return id, nil
+}
+
+func TestServeUserApplicationsHandler(t *testing.T) {
+	idp := newFakeOIDCProvider(t)
+	apps := []Application{
+		{ID: "0oa1", Type: AppNameAWS, Name: "AWS - one"},
+		{ID: "0oa2", Type: "slack", Name: "Slack"},
+	}
+
+	exhausted := NewOktaRateLimits(0.1)
+	exhausted.Observe(oktaRateLimitHeaders(100, 0, time.Now().Add(time.Minute)))
+
+	tests := []struct {
+		name      string
+		path      string
+		token     string
+		handler   ServeUserApplicationsHandler
+		directory *fakeDirectory
+		status    int
+		// user is the user the directory should be asked about, or empty if it should not be asked about any user.
+		user string
+	}{
+		{name: "no token", path: "/v2/applications", status: http.StatusUnauthorized},
+		{name: "token rejected by okta", path: "/v2/applications", token: "expired", status: http.StatusUnauthorized},
+		{name: "malformed userinfo request", path: "/v2/applications", token: "malformed", status: http.StatusInternalServerError},
+		{name: "userinfo unavailable", path: "/v2/applications", token: "broken", status: http.StatusBadGateway},
+		{name: "claims cannot be parsed", path: "/v2/applications", token: "bad-claims", status: http.StatusInternalServerError},
+		{name: "user claim missing", path: "/v2/applications", token: "no-username", status: http.StatusForbidden},
+		{name: "success", path: "/v2/applications", token: "valid", status: http.StatusOK, user: "user@example.com"},
+		{name: "sub claim", path: "/v2/applications", token: "no-username", handler: ServeUserApplicationsHandler{UserClaim: UserClaimSub}, status: http.StatusOK, user: "00u1"},
+		{
+			name:      "email claim",
+			path:      "/v2/applications",
+			token:     "valid",
+			handler:   ServeUserApplicationsHandler{UserClaim: UserClaimEmail},
+			directory: &fakeDirectory{apps: apps, users: map[string]string{"user@example.com": "00u2"}},
+			status:    http.StatusOK,
+			user:      "00u2",
+		},
+		{name: "email not found", path: "/v2/applications", token: "valid", handler: ServeUserApplicationsHandler{UserClaim: UserClaimEmail}, status: http.StatusForbidden},
+		{name: "okta error", path: "/v2/applications", token: "valid", directory: &fakeDirectory{err: errors.New("oops")}, status: http.StatusBadGateway, user: "user@example.com"},
+		{name: "backing off from okta", path: "/v2/applications", token: "valid", handler: ServeUserApplicationsHandler{OktaRateLimits: exhausted}, status: http.StatusTooManyRequests},
+		{
+			name:    "rate limited",
+			path:    "/v2/applications",
+			token:   "valid",
+			handler: ServeUserApplicationsHandler{RateLimiter: NewRateLimiter(Limit{}, Limit{Rate: 0.001, Burst: 1})},
+			status:  http.StatusTooManyRequests,
+		},
+		{name: "roles", path: "/v2/applications/0oa1/roles", token: "valid", directory: &fakeDirectory{apps: apps, roles: []string{"admin"}, users: map[string]string{"user@example.com": "00u1"}}, status: http.StatusOK, user: "user@example.com"},
+		{name: "roles for filtered application", path: "/v2/applications/0oa2/roles", token: "valid", status: http.StatusNotFound, user: "user@example.com"},
+		{name: "roles okta error", path: "/v2/applications/0oa1/roles", token: "valid", directory: &fakeDirectory{apps: apps, rolesErr: errors.New("oops"), users: map[string]string{"user@example.com": "00u1"}}, status: http.StatusBadGateway, user: "user@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.directory == nil {
+				tt.directory = &fakeDirectory{apps: apps}
+			}
+
+			h := tt.handler
+			h.Directory = tt.directory
+			h.Idp = idp
+
+			if h.RateLimiter != nil {
+				// Use up the burst so that the request under test is limited.
+				h.RateLimiter.AllowUser("user@example.com")
+			}
+
+			r := Request{Method: http.MethodGet, Path: tt.path, Headers: map[string]string{}}
+			if tt.token != "" {
+				r.Headers["authorization"] = "Bearer " + tt.token
+			}
+
+			w := NewRouter(h).Handle(context.Background(), r)
+			require.Equal(t, tt.status, statusCode(w), w.Body)
+
+			if tt.status == http.StatusTooManyRequests {
+				assert.NotEmpty(t, w.Headers["Retry-After"])
+			}
+
+			if tt.user == "" {
+				assert.Empty(t, tt.directory.requestedFor)
+				return
+			}
+
+			require.NotEmpty(t, tt.directory.requestedFor)
+			assert.Equal(t, tt.user, tt.directory.requestedFor[0])
+		})
+	}
+}
+
+func TestServeUserApplicationsHandlerFiltersApplications(t *testing.T) {
+	h := ServeUserApplicationsHandler{
+		Idp: newFakeOIDCProvider(t),
+		Directory: &fakeDirectory{apps: []Application{
+			{ID: "0oa1", Type: AppNameAWS, Name: "AWS - one"},
+			{ID: "0oa2", Type: "slack", Name: "Slack"},
+		}},
+	}
+
+	w := h.Handle(context.Background(), Request{Method: http.MethodGet, Headers: map[string]string{"authorization": "Bearer valid"}})
+	require.Equal(t, http.StatusOK, statusCode(w))
+
+	var apps []Application
+	require.NoError(t, json.Unmarshal([]byte(w.Body), &apps))
+	assert.Equal(t, []Application{{ID: "0oa1", Name: "AWS - one", Type: AppNameAWS}}, apps)
+}
+
+func TestServeUserApplicationsHandlerCachesRoles(t *testing.T) {
+	directory := &fakeDirectory{
+		apps:  []Application{{ID: "0oa1", Type: AppNameAWS, Name: "AWS - one"}},
+		roles: []string{"admin"},
+		users: map[string]string{"user@example.com": "00u1"},
+	}
+	h := ServeUserApplicationsHandler{
+		Idp:       newFakeOIDCProvider(t),
+		Directory: directory,
+		Cache:     NewLRUCache(10),
+		CacheTTL:  time.Minute,
+	}
+
+	r := Request{Method: http.MethodGet, Headers: map[string]string{"authorization": "Bearer valid"}, Query: map[string]string{"roles": "true"}}
+	for range 2 {
+		w := h.Handle(context.Background(), r)
+		require.Equal(t, http.StatusOK, statusCode(w), w.Body)
+		assert.JSONEq(t, `[{"@id":"0oa1","name":"AWS - one","type":"amazon_aws","roles":["admin"]}]`, w.Body)
+	}
+
+	w := NewRouter(h).Handle(context.Background(), Request{Method: http.MethodGet, Path: "/v2/applications/0oa1/roles", Headers: r.Headers})
+	require.Equal(t, http.StatusOK, statusCode(w), w.Body)
+
+	// The roles are requested with the ID of the user rather than their login, and only once.
+	assert.Equal(t, []string{"user@example.com", "00u1"}, directory.requestedFor)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StaticDirectory is an ApplicationDirectory read from a YAML file, which is useful for small deployments, identity providers other than Okta and for testing.
+//
+// The file lists the applications, then assigns them to users directly or through groups:
+//
+//	applications:
+//	  - id: "0oa1"
+//	    name: AWS - Production
+//	    type: amazon_aws
+//	    roles: [Admin, ReadOnly]
+//	groups:
+//	  engineering:
+//	    applications: ["0oa1"]
+//	users:
+//	  alice@example.com:
+//	    groups: [engineering]
+//	    applications: []
+//
+// Users are identified by whichever claim the handler is configured to use. The type of an application defaults to amazon_aws.
+type StaticDirectory struct {
+	applications []staticApplication
+	groups       map[string]staticGroup
+	users        map[string]staticUser
+}
+
+type staticApplication struct {
+	ID    string   `yaml:"id"`
+	Name  string   `yaml:"name"`
+	Type  string   `yaml:"type"`
+	Roles []string `yaml:"roles"`
+}
+
+type staticGroup struct {
+	Applications []string `yaml:"applications"`
+}
+
+type staticUser struct {
+	Groups       []string `yaml:"groups"`
+	Applications []string `yaml:"applications"`
+}
+
+type staticDirectoryFile struct {
+	Applications []staticApplication    `yaml:"applications"`
+	Groups       map[string]staticGroup `yaml:"groups"`
+	Users        map[string]staticUser  `yaml:"users"`
+}
+
+// LoadStaticDirectory reads a StaticDirectory from the YAML file at path.
+func LoadStaticDirectory(path string) (*StaticDirectory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, err := ParseStaticDirectory(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+// ParseStaticDirectory reads a StaticDirectory from YAML, checking that every application and group which is referred to exists.
+func ParseStaticDirectory(r io.Reader) (*StaticDirectory, error) {
+	var file staticDirectoryFile
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for i, app := range file.Applications {
+		if app.ID == "" {
+			return nil, fmt.Errorf("application %d has no id", i+1)
+		}
+
+		if ids[app.ID] {
+			return nil, fmt.Errorf("application %s is listed more than once", app.ID)
+		}
+		ids[app.ID] = true
+
+		if app.Type == "" {
+			file.Applications[i].Type = AppNameAWS
+		}
+	}
+
+	for name, group := range file.Groups {
+		for _, id := range group.Applications {
+			if !ids[id] {
+				return nil, fmt.Errorf("group %s refers to unknown application %s", name, id)
+			}
+		}
+	}
+
+	for name, user := range file.Users {
+		for _, id := range user.Applications {
+			if !ids[id] {
+				return nil, fmt.Errorf("user %s refers to unknown application %s", name, id)
+			}
+		}
+
+		for _, group := range user.Groups {
+			if _, ok := file.Groups[group]; !ok {
+				return nil, fmt.Errorf("user %s refers to unknown group %s", name, group)
+			}
+		}
+	}
+
+	return &StaticDirectory{applications: file.Applications, groups: file.Groups, users: file.Users}, nil
+}
+
+// ListApplicationsForUser returns the applications assigned to user directly or through any of their groups. Unknown users have no applications.
+func (d *StaticDirectory) ListApplicationsForUser(ctx context.Context, user string) ([]Application, error) {
+	u := d.users[user]
+	var apps []Application
+	for _, app := range d.applications {
+		if d.assigned(u, app.ID) {
+			apps = append(apps, Application{ID: app.ID, Name: app.Name, Type: app.Type})
+		}
+	}
+	return apps, nil
+}
+
+func (d *StaticDirectory) assigned(u staticUser, appID string) bool {
+	if slices.Contains(u.Applications, appID) {
+		return true
+	}
+
+	for _, group := range u.Groups {
+		if slices.Contains(d.groups[group].Applications, appID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ListGroupsForUser returns the groups of user. The ID and name of each group are both the name it is given in the file.
+func (d *StaticDirectory) ListGroupsForUser(ctx context.Context, user string) ([]Group, error) {
+	var groups []Group
+	for _, name := range d.users[user].Groups {
+		groups = append(groups, Group{ID: name, Name: name})
+	}
+	return groups, nil
+}
+
+// ListRolesForUser returns the roles of the application appID if it is assigned to user.
+func (d *StaticDirectory) ListRolesForUser(ctx context.Context, user, appID string) ([]string, error) {
+	if !d.assigned(d.users[user], appID) {
+		return nil, nil
+	}
+
+	idx := slices.IndexFunc(d.applications, func(app staticApplication) bool { return app.ID == appID })
+	return d.applications[idx].Roles, nil
+}
+
+// LookupUserID returns value if it is the name of a user in the file, whichever claim it came from.
+func (d *StaticDirectory) LookupUserID(ctx context.Context, claim, value string) (string, error) {
+	if _, ok := d.users[value]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUserNotFound, value)
+	}
+	return value, nil
+}
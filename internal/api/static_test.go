@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDirectory = `
+applications:
+  - id: prod
+    name: AWS - Production
+    roles: [Admin, ReadOnly]
+  - id: dev
+    name: AWS - Development
+    roles: [Admin]
+  - id: slack
+    name: Slack
+    type: slack
+groups:
+  engineering:
+    applications: [dev]
+users:
+  alice@example.com:
+    groups: [engineering]
+    applications: [prod, slack]
+  bob@example.com:
+    groups: [engineering]
+`
+
+func TestStaticDirectory(t *testing.T) {
+	ctx := context.Background()
+	d, err := ParseStaticDirectory(strings.NewReader(testDirectory))
+	require.NoError(t, err)
+
+	apps, err := d.ListApplicationsForUser(ctx, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []Application{
+		{ID: "prod", Name: "AWS - Production", Type: AppNameAWS},
+		{ID: "dev", Name: "AWS - Development", Type: AppNameAWS},
+		{ID: "slack", Name: "Slack", Type: "slack"},
+	}, apps)
+
+	apps, err = d.ListApplicationsForUser(ctx, "bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []Application{{ID: "dev", Name: "AWS - Development", Type: AppNameAWS}}, apps)
+
+	apps, err = d.ListApplicationsForUser(ctx, "mallory@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, apps)
+
+	groups, err := d.ListGroupsForUser(ctx, "bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []Group{{ID: "engineering", Name: "engineering"}}, groups)
+
+	roles, err := d.ListRolesForUser(ctx, "alice@example.com", "prod")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Admin", "ReadOnly"}, roles)
+
+	roles, err = d.ListRolesForUser(ctx, "bob@example.com", "prod")
+	require.NoError(t, err)
+	assert.Empty(t, roles, "bob is not assigned prod")
+
+	id, err := d.LookupUserID(ctx, UserClaimEmail, "bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", id)
+
+	_, err = d.LookupUserID(ctx, UserClaimEmail, "mallory@example.com")
+	assert.True(t, errors.Is(err, ErrUserNotFound))
+}
+
+func TestParseStaticDirectoryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{name: "missing id", yaml: "applications: [{name: prod}]", err: "application 1 has no id"},
+		{name: "duplicate id", yaml: "applications: [{id: prod}, {id: prod}]", err: "listed more than once"},
+		{name: "unknown application in group", yaml: "groups: {eng: {applications: [prod]}}", err: "group eng refers to unknown application prod"},
+		{name: "unknown application for user", yaml: "users: {alice: {applications: [prod]}}", err: "user alice refers to unknown application prod"},
+		{name: "unknown group", yaml: "users: {alice: {groups: [eng]}}", err: "user alice refers to unknown group eng"},
+		{name: "unknown field", yaml: "applications: [{id: prod, label: Prod}]", err: "field label not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStaticDirectory(strings.NewReader(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestServeUserApplicationsHandlerWithStaticDirectory(t *testing.T) {
+	d, err := ParseStaticDirectory(strings.NewReader(testDirectory))
+	require.NoError(t, err)
+
+	h := ServeUserApplicationsHandler{Directory: d, Idp: newFakeOIDCProvider(t)}
+	r := Request{Method: http.MethodGet, Path: "/v2/applications/prod/roles", Headers: map[string]string{"authorization": "Bearer valid"}}
+	w := NewRouter(h).Handle(context.Background(), r)
+	require.Equal(t, http.StatusNotFound, statusCode(w), "user@example.com is not in the directory")
+
+	d.users["user@example.com"] = staticUser{Applications: []string{"prod"}}
+	w = NewRouter(h).Handle(context.Background(), r)
+	require.Equal(t, http.StatusOK, statusCode(w), w.Body)
+	assert.JSONEq(t, `{"@id":"prod","name":"AWS - Production","type":"amazon_aws","roles":["Admin","ReadOnly"]}`, w.Body)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIssuer = "https://example.okta.com"
+
+// rsaKeySet is an oidc.KeySet which verifies RS256 signatures made with a single key.
+type rsaKeySet struct {
+	key *rsa.PublicKey
+}
+
+func (k rsaKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	parts := strings.Split(jwt, ".")
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(k.key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestTokenVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	v := TokenVerifier{
+		Verifier:       oidc.NewVerifier(testIssuer, rsaKeySet{&key.PublicKey}, &oidc.Config{SkipClientIDCheck: true}),
+		Audiences:      []string{"client-id", "api://keyconjurer"},
+		RequiredScopes: []string{"openid"},
+	}
+
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":                testIssuer,
+			"aud":                "client-id",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"sub":                "00u1",
+			"preferred_username": "user@example.com",
+			"scp":                []string{"openid", "profile"},
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{name: "valid", token: signJWT(t, key, claims(nil))},
+		{name: "audience list", token: signJWT(t, key, claims(map[string]any{"aud": []string{"other", "api://keyconjurer"}}))},
+		{name: "scope string", token: signJWT(t, key, claims(map[string]any{"scp": nil, "scope": "openid email"}))},
+		{name: "opaque", token: "00abcdef", err: ErrOpaqueToken},
+		{name: "wrong audience", token: signJWT(t, key, claims(map[string]any{"aud": "other"})), err: ErrInvalidToken},
+		{name: "wrong issuer", token: signJWT(t, key, claims(map[string]any{"iss": "https://evil.example.com"})), err: ErrInvalidToken},
+		{name: "expired", token: signJWT(t, key, claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), err: ErrInvalidToken},
+		{name: "missing scope", token: signJWT(t, key, claims(map[string]any{"scp": []string{"profile"}})), err: ErrInvalidToken},
+		{name: "wrong key", token: signJWT(t, other, claims(nil)), err: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(context.Background(), tt.token)
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err), "expected %v, got %v", tt.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "user@example.com", got.PreferredUsername)
+		})
+	}
+}
+
+func TestAuthenticateWithTokenVerifier(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	h := ServeUserApplicationsHandler{
+		TokenVerifier: &TokenVerifier{
+			Verifier:  oidc.NewVerifier(testIssuer, rsaKeySet{&key.PublicKey}, &oidc.Config{SkipClientIDCheck: true}),
+			Audiences: []string{"client-id"},
+		},
+	}
+
+	token := signJWT(t, key, map[string]any{
+		"iss":                testIssuer,
+		"aud":                "client-id",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "user@example.com",
+	})
+
+	event := &AuditEvent{}
+	ctx := context.WithValue(context.Background(), auditEventKey{}, event)
+	var w Response
+	user, ok := h.authenticate(ctx, Request{Headers: map[string]string{"authorization": "Bearer " + token}}, &w, nil)
+	require.True(t, ok, "a valid JWT should be accepted without calling the userinfo endpoint")
+	assert.Equal(t, "user@example.com", user)
+	assert.Equal(t, "user@example.com", event.User)
+
+	token = signJWT(t, key, map[string]any{
+		"iss":                testIssuer,
+		"aud":                "someone-else",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"preferred_username": "user@example.com",
+	})
+
+	w = Response{}
+	_, ok = h.authenticate(ctx, Request{Headers: map[string]string{"authorization": "Bearer " + token}}, &w, nil)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, w.StatusCode)
+}
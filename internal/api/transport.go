@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// MaxRequestBodySize is the largest request body, in bytes, the HTTP transport will read.
+const MaxRequestBodySize = 1 << 20
+
+// Request is an HTTP request received through any of the transports the server supports.
+type Request struct {
+	Method string
+	// Path is the path of the request as it was sent, which may contain escaped characters.
+	Path string
+	// Headers holds the request headers. Keys are always lowercase.
+	Headers map[string]string
+	Query   map[string]string
+	Body    string
+	// PathParams holds the values of the parameters in the path pattern the request was routed with.
+	PathParams map[string]string
+}
+
+// Header returns the value of the named header, regardless of the case of name.
+func (r Request) Header(name string) string {
+	return r.Headers[strings.ToLower(name)]
+}
+
+// Response is an HTTP response which can be returned through any of the transports the server supports.
+type Response struct {
+	StatusCode int
+	Headers    map[string]string
+	Body       string
+}
+
+// Handler serves requests independently of how they were received.
+type Handler interface {
+	Handle(ctx context.Context, r Request) Response
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, r Request) Response
+
+func (f HandlerFunc) Handle(ctx context.Context, r Request) Response {
+	return f(ctx, r)
+}
+
+func lowercaseKeys(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+func decodeBody(body string, isBase64Encoded bool) string {
+	if !isBase64Encoded {
+		return body
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return ""
+	}
+	return string(buf)
+}
+
+func statusCode(w Response) int {
+	if w.StatusCode == 0 {
+		return http.StatusOK
+	}
+	return w.StatusCode
+}
+
+// ALBHandler serves h as a Lambda function behind an Application Load Balancer.
+func ALBHandler(h Handler) lambda.Handler {
+	return lambda.NewHandler(func(ctx context.Context, r events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+		w := h.Handle(ctx, Request{
+			Method:  r.HTTPMethod,
+			Path:    r.Path,
+			Headers: lowercaseKeys(r.Headers),
+			Query:   r.QueryStringParameters,
+			Body:    decodeBody(r.Body, r.IsBase64Encoded),
+		})
+
+		return events.ALBTargetGroupResponse{
+			StatusCode: statusCode(w),
+			Headers:    w.Headers,
+			Body:       w.Body,
+		}, nil
+	})
+}
+
+// APIGatewayHandler serves h as a Lambda function behind an API Gateway REST API, which uses version 1.0 of the payload format.
+func APIGatewayHandler(h Handler) lambda.Handler {
+	return lambda.NewHandler(func(ctx context.Context, r events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		w := h.Handle(ctx, Request{
+			Method:  r.HTTPMethod,
+			Path:    r.Path,
+			Headers: lowercaseKeys(r.Headers),
+			Query:   r.QueryStringParameters,
+			Body:    decodeBody(r.Body, r.IsBase64Encoded),
+		})
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: statusCode(w),
+			Headers:    w.Headers,
+			Body:       w.Body,
+		}, nil
+	})
+}
+
+// APIGatewayV2Handler serves h as a Lambda function behind an API Gateway HTTP API, which uses version 2.0 of the payload format.
+func APIGatewayV2Handler(h Handler) lambda.Handler {
+	return lambda.NewHandler(func(ctx context.Context, r events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		w := h.Handle(ctx, Request{
+			Method:  r.RequestContext.HTTP.Method,
+			Path:    r.RawPath,
+			Headers: lowercaseKeys(r.Headers),
+			Query:   r.QueryStringParameters,
+			Body:    decodeBody(r.Body, r.IsBase64Encoded),
+		})
+
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: statusCode(w),
+			Headers:    w.Headers,
+			Body:       w.Body,
+		}, nil
+	})
+}
+
+// HTTPHandler serves h using net/http.
+func HTTPHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, MaxRequestBodySize))
+		if err != nil {
+			http.Error(rw, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		headers := make(map[string]string, len(r.Header))
+		for k, v := range r.Header {
+			headers[strings.ToLower(k)] = strings.Join(v, ",")
+		}
+
+		query := make(map[string]string)
+		for k, v := range r.URL.Query() {
+			query[k] = v[0]
+		}
+
+		w := h.Handle(r.Context(), Request{
+			Method:  r.Method,
+			Path:    r.URL.EscapedPath(),
+			Headers: headers,
+			Query:   query,
+			Body:    string(body),
+		})
+
+		for k, v := range w.Headers {
+			rw.Header().Set(k, v)
+		}
+		rw.WriteHeader(statusCode(w))
+		io.WriteString(rw, w.Body)
+	})
+}
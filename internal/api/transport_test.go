@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler serves the request it received as JSON.
+var echoHandler = HandlerFunc(func(ctx context.Context, r Request) (w Response) {
+	ServeJSON(&w, r)
+	return
+})
+
+func TestHTTPHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v2/applications?refresh=true", strings.NewReader("body"))
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+
+	HTTPHandler(echoHandler).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got Request
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, http.MethodPost, got.Method)
+	assert.Equal(t, "/v2/applications", got.Path)
+	assert.Equal(t, "Bearer token", got.Header("Authorization"))
+	assert.Equal(t, "true", got.Query["refresh"])
+	assert.Equal(t, "body", got.Body)
+}
+
+func TestHTTPHandlerKeepsPathEscaped(t *testing.T) {
+	var rt Router
+	rt.Route([]string{http.MethodGet}, "/v2/applications/{id}/roles", HandlerFunc(func(ctx context.Context, r Request) (w Response) {
+		w.Body = r.PathParams["id"]
+		return
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v2/applications/0oa%2F1/roles", nil)
+	rec := httptest.NewRecorder()
+	HTTPHandler(&rt).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0oa/1", rec.Body.String())
+}
+
+func TestHTTPHandlerRejectsLargeBodies(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v2/applications", strings.NewReader(strings.Repeat("a", MaxRequestBodySize+1)))
+	rec := httptest.NewRecorder()
+
+	HTTPHandler(echoHandler).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestLambdaHandlers(t *testing.T) {
+	tests := []struct {
+		name    string
+		adapter func(Handler) lambda.Handler
+		event   any
+	}{
+		{
+			name:    "alb",
+			adapter: ALBHandler,
+			event:   events.ALBTargetGroupRequest{HTTPMethod: "POST", Path: "/v2/applications", Headers: map[string]string{"Authorization": "Bearer token"}, Body: "Ym9keQ==", IsBase64Encoded: true},
+		},
+		{
+			name:    "apigateway",
+			adapter: APIGatewayHandler,
+			event:   events.APIGatewayProxyRequest{HTTPMethod: "POST", Path: "/v2/applications", Headers: map[string]string{"Authorization": "Bearer token"}, Body: "body"},
+		},
+		{
+			name:    "apigatewayv2",
+			adapter: APIGatewayV2Handler,
+			event: events.APIGatewayV2HTTPRequest{
+				RawPath:        "/v2/applications",
+				Headers:        map[string]string{"authorization": "Bearer token"},
+				Body:           "body",
+				RequestContext: events.APIGatewayV2HTTPRequestContext{HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: "POST"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := json.Marshal(tc.event)
+			require.NoError(t, err)
+
+			out, err := tc.adapter(echoHandler).Invoke(context.Background(), payload)
+			require.NoError(t, err)
+
+			var resp struct {
+				StatusCode int    `json:"statusCode"`
+				Body       string `json:"body"`
+			}
+			require.NoError(t, json.Unmarshal(out, &resp))
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			var got Request
+			require.NoError(t, json.Unmarshal([]byte(resp.Body), &got))
+			assert.Equal(t, "POST", got.Method)
+			assert.Equal(t, "/v2/applications", got.Path)
+			assert.Equal(t, "Bearer token", got.Header("authorization"))
+			assert.Equal(t, "body", got.Body)
+		})
+	}
+}
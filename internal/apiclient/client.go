@@ -0,0 +1,240 @@
+// Package apiclient is a client for the KeyConjurer account server.
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"log/slog"
+
+	"github.com/riotgames/key-conjurer/internal/api"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultMaxResponseSize is the largest response body, in bytes, the client will read.
+	DefaultMaxResponseSize int64 = 10 << 20
+	// DefaultMaxRetries is how many times a request is retried after a 429 or 5xx response.
+	DefaultMaxRetries = 3
+	// DefaultMaxRetryAfter is the longest the client will wait when the server asks it to retry later.
+	DefaultMaxRetryAfter = 30 * time.Second
+)
+
+var (
+	// ErrUnauthorized indicates the server did not accept the access token, and the user must login again.
+	ErrUnauthorized = errors.New("the account server did not accept your credentials")
+	// ErrForbidden indicates the server understood the request but refused to serve it.
+	ErrForbidden = errors.New("the account server refused the request")
+	// ErrResponseTooLarge indicates the response body exceeded the maximum response size.
+	ErrResponseTooLarge = errors.New("response from the account server was too large")
+)
+
+// StatusError is returned when the server responds with a status code the client does not otherwise handle, or continues to respond with a retryable status code after all retries are exhausted.
+type StatusError struct {
+	StatusCode int
+	// Message is the error message from the response body, if it contained one.
+	Message string
+	// RetryAfter is the delay requested by the server through the Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("account server responded with status code %d", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", e.RetryAfter)
+	}
+	return msg
+}
+
+// Client talks to the account server.
+type Client struct {
+	BaseURL    *url.URL
+	HTTPClient *http.Client
+	// MaxResponseSize is the largest response body, in bytes, that will be read.
+	MaxResponseSize int64
+	// MaxRetries is how many times a request is retried after a 429 or 5xx response.
+	MaxRetries int
+	// MaxRetryAfter is the longest the client will wait between retries. Requests which the server asks to be retried after a longer delay fail immediately.
+	MaxRetryAfter time.Duration
+	// Backoff returns how long to wait before the given retry attempt, starting at 1, when the server did not specify a delay.
+	Backoff func(attempt int) time.Duration
+}
+
+// New returns a client for the account server at baseURL which authenticates requests using ts. If ts is nil, requests are not authenticated.
+func New(ctx context.Context, baseURL *url.URL, ts oauth2.TokenSource) *Client {
+	return &Client{
+		BaseURL:         baseURL,
+		HTTPClient:      oauth2.NewClient(ctx, ts),
+		MaxResponseSize: DefaultMaxResponseSize,
+		MaxRetries:      DefaultMaxRetries,
+		MaxRetryAfter:   DefaultMaxRetryAfter,
+		Backoff:         exponentialBackoff,
+	}
+}
+
+func exponentialBackoff(attempt int) time.Duration {
+	return time.Duration(1<<(attempt-1)) * 500 * time.Millisecond
+}
+
+// ListApplications returns the applications the user has access to.
+func (c *Client) ListApplications(ctx context.Context) ([]api.Application, error) {
+	var apps []api.Application
+	if err := c.do(ctx, http.MethodPost, "/v2/applications", &apps); err != nil {
+		return nil, err
+	}
+	return apps, nil
+}
+
+// Version returns information about the build of the account server.
+//
+// Servers which predate this endpoint do not recognize it, and return an error.
+func (c *Client) Version(ctx context.Context) (api.VersionInfo, error) {
+	var info api.VersionInfo
+	err := c.do(ctx, http.MethodGet, "/version", &info)
+	return info, err
+}
+
+// ListRoles returns the names of the roles the user may assume in the application with the given ID.
+//
+// Servers which predate this endpoint do not recognize it, and return an error.
+func (c *Client) ListRoles(ctx context.Context, appID string) ([]string, error) {
+	var app api.Application
+	if err := c.do(ctx, http.MethodGet, "/v2/applications/"+url.PathEscape(appID)+"/roles", &app); err != nil {
+		return nil, err
+	}
+	return app.Roles, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out any) error {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	uri := c.BaseURL.ResolveReference(ref)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, uri.String(), nil)
+		if err != nil {
+			return err
+		}
+
+		body, statusErr, err := c.roundTrip(req)
+		if err != nil {
+			return err
+		}
+
+		if statusErr == nil {
+			if err := json.Unmarshal(body, out); err != nil {
+				return fmt.Errorf("failed to parse response from account server: %w", err)
+			}
+			return nil
+		}
+
+		if !retryable(statusErr.StatusCode) || attempt >= c.MaxRetries {
+			return statusErr
+		}
+
+		delay := statusErr.RetryAfter
+		if delay == 0 && c.Backoff != nil {
+			delay = c.Backoff(attempt + 1)
+		}
+
+		if delay > c.MaxRetryAfter {
+			return statusErr
+		}
+
+		slog.Debug("retrying request to account server", slog.Int("status_code", statusErr.StatusCode), slog.Duration("delay", delay))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// roundTrip sends req and reads the response. A *StatusError is returned separately from other errors for responses with a status code which might be retried.
+func (c *Client) roundTrip(req *http.Request) ([]byte, *StatusError, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	limit := c.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxResponseSize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read body: %w", err)
+	}
+
+	if int64(len(body)) > limit {
+		return nil, nil, ErrResponseTooLarge
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return body, nil, nil
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusForbidden:
+		if msg := errorMessage(body); msg != "" {
+			return nil, nil, fmt.Errorf("%w: %s", ErrForbidden, msg)
+		}
+		return nil, nil, ErrForbidden
+	}
+
+	statusErr := &StatusError{
+		StatusCode: resp.StatusCode,
+		Message:    errorMessage(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	if retryable(resp.StatusCode) {
+		return nil, statusErr, nil
+	}
+
+	return nil, nil, statusErr
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// errorMessage returns the message from a JSON error body produced by the account server, or an empty string if the body is not one.
+func errorMessage(body []byte) string {
+	var jsonError api.JSONError
+	if err := json.Unmarshal(body, &jsonError); err != nil {
+		return ""
+	}
+	return jsonError.Message
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which may be either a number of seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,225 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/riotgames/key-conjurer/internal/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type response struct {
+	status int
+	header http.Header
+	body   string
+}
+
+// sequenceHandler serves each response in turn, repeating the last one once the list is exhausted.
+func sequenceHandler(responses []response, calls *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(calls, 1)) - 1
+		if n >= len(responses) {
+			n = len(responses) - 1
+		}
+
+		resp := responses[n]
+		for k, v := range resp.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.status)
+		w.Write([]byte(resp.body))
+	}
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	baseURL, _ := url.Parse(srv.URL)
+	client := New(context.Background(), baseURL, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+	client.Backoff = func(int) time.Duration { return time.Millisecond }
+	return client
+}
+
+func TestListApplications(t *testing.T) {
+	apps, _ := json.Marshal([]api.Application{{ID: "1", Name: "AWS - one"}})
+	jsonError := func(msg string) string {
+		buf, _ := json.Marshal(api.JSONError{Message: msg})
+		return string(buf)
+	}
+
+	tests := []struct {
+		name      string
+		responses []response
+		wantCalls int32
+		wantApps  []api.Application
+		check     func(t *testing.T, err error)
+	}{
+		{
+			name:      "ok",
+			responses: []response{{status: http.StatusOK, body: string(apps)}},
+			wantCalls: 1,
+			wantApps:  []api.Application{{ID: "1", Name: "AWS - one"}},
+		},
+		{
+			name:      "unauthorized",
+			responses: []response{{status: http.StatusUnauthorized, body: jsonError("unauthorized")}},
+			wantCalls: 1,
+			check:     func(t *testing.T, err error) { assert.ErrorIs(t, err, ErrUnauthorized) },
+		},
+		{
+			name:      "forbidden",
+			responses: []response{{status: http.StatusForbidden, body: jsonError("not allowed")}},
+			wantCalls: 1,
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrForbidden)
+				assert.Contains(t, err.Error(), "not allowed")
+			},
+		},
+		{
+			name: "rate limited then ok",
+			responses: []response{
+				{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"0"}}},
+				{status: http.StatusOK, body: string(apps)},
+			},
+			wantCalls: 2,
+			wantApps:  []api.Application{{ID: "1", Name: "AWS - one"}},
+		},
+		{
+			name:      "rate limited for too long",
+			responses: []response{{status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"3600"}}}},
+			wantCalls: 1,
+			check: func(t *testing.T, err error) {
+				var statusErr *StatusError
+				require.ErrorAs(t, err, &statusErr)
+				assert.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+				assert.Equal(t, time.Hour, statusErr.RetryAfter)
+			},
+		},
+		{
+			name: "server error then ok",
+			responses: []response{
+				{status: http.StatusBadGateway, body: jsonError("upstream error")},
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusOK, body: string(apps)},
+			},
+			wantCalls: 3,
+			wantApps:  []api.Application{{ID: "1", Name: "AWS - one"}},
+		},
+		{
+			name:      "server error after retries",
+			responses: []response{{status: http.StatusBadGateway, body: jsonError("upstream error")}},
+			wantCalls: DefaultMaxRetries + 1,
+			check: func(t *testing.T, err error) {
+				var statusErr *StatusError
+				require.ErrorAs(t, err, &statusErr)
+				assert.Equal(t, http.StatusBadGateway, statusErr.StatusCode)
+				assert.Equal(t, "upstream error", statusErr.Message)
+			},
+		},
+		{
+			name:      "not found is not retried",
+			responses: []response{{status: http.StatusNotFound}},
+			wantCalls: 1,
+			check: func(t *testing.T, err error) {
+				var statusErr *StatusError
+				require.ErrorAs(t, err, &statusErr)
+				assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+			},
+		},
+		{
+			name:      "malformed body",
+			responses: []response{{status: http.StatusOK, body: "{"}},
+			wantCalls: 1,
+			check:     func(t *testing.T, err error) { assert.ErrorContains(t, err, "failed to parse response") },
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			client := newTestClient(t, sequenceHandler(tc.responses, &calls))
+
+			got, err := client.ListApplications(context.Background())
+			if tc.check != nil {
+				tc.check(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.wantApps, got)
+			assert.Equal(t, tc.wantCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestListApplicationsLimitsResponseSize(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, sequenceHandler([]response{{status: http.StatusOK, body: "[" + strings.Repeat(" ", 64) + "]"}}, &calls))
+	client.MaxResponseSize = 32
+
+	_, err := client.ListApplications(context.Background())
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestListApplicationsSendsBearerToken(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v2/applications", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte("[]"))
+	}))
+
+	_, err := client.ListApplications(context.Background())
+	require.NoError(t, err)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestListRoles(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v2/applications/0oa%2F1/roles", r.URL.EscapedPath())
+		json.NewEncoder(w).Encode(api.Application{ID: "0oa/1", Roles: []string{"Admin", "ReadOnly"}})
+	}))
+
+	roles, err := client.ListRoles(context.Background(), "0oa/1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Admin", "ReadOnly"}, roles)
+}
+
+func TestListRolesFromOldServer(t *testing.T) {
+	// Servers without the roles endpoint served the application list for every path.
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]api.Application{{ID: "1", Name: "AWS - one"}})
+	}))
+
+	_, err := client.ListRoles(context.Background(), "1")
+	assert.Error(t, err)
+}
+
+func TestVersion(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/version", r.URL.Path)
+		json.NewEncoder(w).Encode(api.VersionInfo{Version: "1.2.3", APIVersion: api.APIVersion})
+	}))
+
+	info, err := client.Version(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, api.APIVersion, info.APIVersion)
+}
@@ -3,12 +3,14 @@ package oktawebsso
 import (
 	"errors"
 	"net/url"
+	"strings"
 
 	"golang.org/x/net/html"
 )
 
 type Form struct {
 	Method string
+	Action string
 	Inputs map[string]string
 }
 
@@ -79,6 +81,7 @@ func collectFormValues(node *html.Node) (Form, error) {
 	}
 
 	f.Method, _ = getAttribute(node.Attr, "method")
+	f.Action, _ = getAttribute(node.Attr, "action")
 	Walk(node, func(node *html.Node) bool {
 		if node.Data != "input" {
 			return false
@@ -117,3 +120,27 @@ func FindFirstForm(tree *html.Node) (Form, bool) {
 	form, err := collectFormValues(formNode)
 	return form, err == nil
 }
+
+// TextContent returns the text within the given HTML node, excluding scripts and styles, with runs of whitespace collapsed to a single space.
+func TextContent(node *html.Node) string {
+	var b strings.Builder
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			b.WriteString(node.Data)
+			b.WriteByte(' ')
+			return
+		}
+
+		if node.Type == html.ElementNode && (node.Data == "script" || node.Data == "style") {
+			return
+		}
+
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+
+	visit(node)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,138 @@
+package oktawebsso
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// ErrStepUpRequired indicates that Okta requires the user to verify their identity again, such as with MFA, before it will sign them in to the application.
+	ErrStepUpRequired = errors.New("additional verification required")
+	// ErrAccessDenied indicates that the user is not allowed to sign in to the application, usually because it is not assigned to them.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrSessionExpired indicates that Okta asked the user to sign in again.
+	ErrSessionExpired = errors.New("session expired")
+	// ErrRateLimited indicates that Okta refused the request because too many requests have been made.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// PageError is returned by GetSAMLAssertion when Okta serves a page other than the form containing the SAML assertion.
+type PageError struct {
+	// Reason is ErrStepUpRequired, ErrAccessDenied, ErrSessionExpired or ErrRateLimited, or ErrNoSAMLAssertion if the page was not recognised.
+	Reason     error
+	StatusCode int
+	// Title is the title of the page, which is useful when reporting pages which were not recognised.
+	Title string
+	// Action is the action of the first form on the page, if it has one.
+	Action string
+}
+
+func (e *PageError) Error() string {
+	msg := fmt.Sprintf("%s (okta returned %d %s", e.Reason, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Title != "" {
+		msg += fmt.Sprintf(" with page %q", e.Title)
+	}
+	return msg + ")"
+}
+
+func (e *PageError) Unwrap() error {
+	return e.Reason
+}
+
+// pageMarkers are the signs that a page served by Okta is of a particular kind. A page matches if any one of the markers is present.
+type pageMarkers struct {
+	Reason      error
+	StatusCodes []int
+	// Actions are substrings of the path of the action of the first form on the page.
+	Actions []string
+	// Titles are substrings of the lower-cased title of the page.
+	Titles []string
+	// Text are substrings of the lower-cased text of the page, including its title.
+	Text []string
+}
+
+// knownPages are checked in order, so pages which may share markers with later entries must come first.
+// For example, step-up pages often include a link back to the sign in page.
+var knownPages = []pageMarkers{
+	{
+		Reason:      ErrRateLimited,
+		StatusCodes: []int{http.StatusTooManyRequests},
+		Text:        []string{"too many requests", "rate limit exceeded"},
+	},
+	{
+		Reason: ErrStepUpRequired,
+		// Identity Engine orgs post both the sign in form and verification forms to /idp/idx/, so only the paths used for verification are step-up markers.
+		Actions: []string{"/login/step-up", "/signin/verify", "/idp/idx/challenge", "/idp/idx/authenticators", "/login/second-factor"},
+		Text:    []string{"verify it's you", "verify it’s you", "additional verification", "extra verification"},
+	},
+	{
+		Reason:      ErrAccessDenied,
+		StatusCodes: []int{http.StatusForbidden},
+		Text:        []string{"not assigned", "access denied", "do not have permission", "don't have permission", "don’t have permission"},
+	},
+	{
+		Reason:      ErrSessionExpired,
+		StatusCodes: []int{http.StatusUnauthorized},
+		Actions:     []string{"/login/login.htm", "/signin", "/login/sessioncookieredirect", "/idp/idx/identify"},
+		Titles:      []string{"sign in"},
+		Text:        []string{"session expired", "session has expired"},
+	},
+}
+
+func (m pageMarkers) match(statusCode int, action, title, text string) bool {
+	if slices.Contains(m.StatusCodes, statusCode) {
+		return true
+	}
+
+	if action != "" && slices.ContainsFunc(m.Actions, func(s string) bool { return strings.Contains(action, s) }) {
+		return true
+	}
+
+	if slices.ContainsFunc(m.Titles, func(s string) bool { return strings.Contains(title, s) }) {
+		return true
+	}
+
+	return slices.ContainsFunc(m.Text, func(s string) bool { return strings.Contains(text, s) })
+}
+
+// ClassifyPage determines why a page served by Okta's web SSO endpoint did not contain a SAML assertion.
+func ClassifyPage(statusCode int, doc *html.Node) *PageError {
+	e := &PageError{Reason: ErrNoSAMLAssertion, StatusCode: statusCode, Title: pageTitle(doc)}
+	if form, ok := FindFirstForm(doc); ok {
+		e.Action = form.Action
+	}
+
+	var action string
+	if u, err := url.Parse(e.Action); err == nil {
+		action = strings.ToLower(u.Path)
+	}
+
+	title := strings.ToLower(e.Title)
+	text := strings.ToLower(TextContent(doc))
+	for _, page := range knownPages {
+		if page.match(statusCode, action, title, text) {
+			e.Reason = page.Reason
+			break
+		}
+	}
+
+	return e
+}
+
+func pageTitle(doc *html.Node) string {
+	var title string
+	Walk(doc, func(node *html.Node) bool {
+		if node.Data == "title" {
+			title = TextContent(node)
+			return true
+		}
+		return false
+	})
+	return title
+}
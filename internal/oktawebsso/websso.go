@@ -1,9 +1,11 @@
 package oktawebsso
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 
@@ -16,8 +18,13 @@ var (
 	ErrNoSAMLAssertion = errors.New("no saml assertion")
 	// ErrNotOIDCToken indicates that the token provided was not an OIDC token and thus cannot be used with the RFC8693 exchange flow.
 	ErrNotOIDCToken = errors.New("not oidc token")
+	// ErrAssertionResponseTooLarge indicates that the response from an assertion endpoint was larger than will be read.
+	ErrAssertionResponseTooLarge = errors.New("saml assertion response too large")
 )
 
+// DefaultMaxAssertionResponseSize is the largest response body, in bytes, that will be read from an assertion endpoint.
+const DefaultMaxAssertionResponseSize int64 = 1 << 20
+
 // WebSSOToken is a special type of oauth2 token used in Okta's undocumented "web sso" login flow.
 type WebSSOToken *oauth2.Token
 
@@ -52,6 +59,8 @@ func ExchangeAccessToken(ctx context.Context, cfg *oauth2.Config, ts oauth2.Toke
 // GetSAMLAssertion is an Okta-specific API which exchanges an Okta Web SSO token, which is obtained by exchanging an OAuth2 token using the RFC8693 Token Exchange Flow, for a SAML assertion.
 //
 // It is not standards compliant, but is used by Okta in their own okta-aws-cli.
+//
+// If Okta responds with any other page, a *PageError describing the page is returned.
 func GetSAMLAssertion(ctx context.Context, issuer string, token WebSSOToken) ([]byte, error) {
 	data := url.Values{"token": {token.AccessToken}}
 	uri := fmt.Sprintf("%s/login/token/sso?%s", issuer, data.Encode())
@@ -67,21 +76,29 @@ func GetSAMLAssertion(ctx context.Context, issuer string, token WebSSOToken) ([]
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return nil, errors.New("internal okta error occurred")
+	body, err := io.ReadAll(io.LimitReader(resp.Body, DefaultMaxAssertionResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read okta response: %w", err)
 	}
 
-	doc, _ := html.Parse(resp.Body)
-	form, ok := FindFirstForm(doc)
-	if !ok {
-		return nil, ErrNoSAMLAssertion
+	if int64(len(body)) > DefaultMaxAssertionResponseSize {
+		return nil, ErrAssertionResponseTooLarge
 	}
 
-	saml, ok := form.Inputs["SAMLResponse"]
-	if !ok {
-		return nil, ErrNoSAMLAssertion
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse okta response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if form, ok := FindFirstForm(doc); ok {
+			if saml, ok := form.Inputs["SAMLResponse"]; ok {
+				return []byte(saml), nil
+			}
+		}
 	}
 
-	return []byte(saml), nil
+	return nil, ClassifyPage(resp.StatusCode, doc)
 }
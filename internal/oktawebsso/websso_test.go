@@ -0,0 +1,85 @@
+package oktawebsso
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestGetSAMLAssertion(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		statusCode int
+		err        error
+		action     string
+	}{
+		{fixture: "saml.html", statusCode: http.StatusOK},
+		{fixture: "stepup.html", statusCode: http.StatusOK, err: ErrStepUpRequired, action: "https://example.okta.com/login/step-up/redirect?stateToken=abc"},
+		{fixture: "notassigned.html", statusCode: http.StatusOK, err: ErrAccessDenied},
+		{fixture: "notassigned.html", statusCode: http.StatusForbidden, err: ErrAccessDenied},
+		{fixture: "signin.html", statusCode: http.StatusOK, err: ErrSessionExpired, action: "https://example.okta.com/login/sessionCookieRedirect"},
+		{fixture: "signin-oie.html", statusCode: http.StatusOK, err: ErrSessionExpired, action: "https://example.okta.com/idp/idx/identify"},
+		{fixture: "stepup-oie.html", statusCode: http.StatusOK, err: ErrStepUpRequired, action: "https://example.okta.com/idp/idx/challenge/answer"},
+		{fixture: "ratelimited.html", statusCode: http.StatusTooManyRequests, err: ErrRateLimited},
+		{fixture: "unknown.html", statusCode: http.StatusOK, err: ErrNoSAMLAssertion},
+		{fixture: "unknown.html", statusCode: http.StatusServiceUnavailable, err: ErrNoSAMLAssertion},
+		// A SAML assertion served with an error status should not be trusted.
+		{fixture: "saml.html", statusCode: http.StatusInternalServerError, err: ErrNoSAMLAssertion, action: "https://signin.aws.amazon.com/saml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture+" "+http.StatusText(tt.statusCode), func(t *testing.T) {
+			page, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			require.NoError(t, err)
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/login/token/sso", r.URL.Path)
+				assert.Equal(t, "websso", r.URL.Query().Get("token"))
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(tt.statusCode)
+				w.Write(page)
+			}))
+			defer srv.Close()
+
+			assertion, err := GetSAMLAssertion(context.Background(), srv.URL, &oauth2.Token{AccessToken: "websso"})
+			if tt.err == nil {
+				require.NoError(t, err)
+				assert.Equal(t, "PHNhbWxwOlJlc3BvbnNlLz4=", string(assertion))
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.err), "expected %v, got %v", tt.err, err)
+			var pageErr *PageError
+			require.True(t, errors.As(err, &pageErr))
+			assert.Equal(t, tt.statusCode, pageErr.StatusCode)
+			assert.Equal(t, tt.action, pageErr.Action)
+			assert.NotEmpty(t, pageErr.Title)
+		})
+	}
+}
+
+func TestGetSAMLAssertionResponseTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>"))
+		w.Write(bytes.Repeat([]byte("a"), int(DefaultMaxAssertionResponseSize)))
+	}))
+	defer srv.Close()
+
+	_, err := GetSAMLAssertion(context.Background(), srv.URL, &oauth2.Token{AccessToken: "websso"})
+	assert.ErrorIs(t, err, ErrAssertionResponseTooLarge)
+}
+
+func TestPageErrorMessage(t *testing.T) {
+	err := &PageError{Reason: ErrNoSAMLAssertion, StatusCode: http.StatusOK, Title: "Example - Maintenance"}
+	assert.Equal(t, `no saml assertion (okta returned 200 OK with page "Example - Maintenance")`, err.Error())
+}
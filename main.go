@@ -12,7 +12,6 @@ import (
 	"log/slog"
 
 	"github.com/riotgames/key-conjurer/command"
-	"github.com/spf13/cobra"
 )
 
 const (
@@ -38,10 +37,67 @@ func init() {
 	slog.SetDefault(slog.New(handler))
 }
 
+// splitArgs splits s into arguments the same way a POSIX shell would, honouring single quotes, double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
 func main() {
 	args := os.Args[1:]
 	if flag, ok := os.LookupEnv("KEYCONJURERFLAGS"); ok {
-		args = append(args, strings.Split(flag, " ")...)
+		extra, err := splitArgs(flag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "KEYCONJURERFLAGS could not be parsed: %s\n", err)
+			os.Exit(command.ExitCodeValueError)
+		}
+		args = append(args, extra...)
 	}
 
 	err := command.Execute(context.Background(), args)
@@ -57,11 +113,13 @@ func main() {
 	}
 
 	if err != nil {
-		cobra.CheckErr(err)
+		// cobra.CheckErr is not used because it exits with status 1, discarding the exit code of the error.
+		fmt.Fprintln(os.Stderr, "Error:", err)
 
 		errorCode, ok := command.GetExitCode(err)
 		if !ok {
-			errorCode = command.ExitCodeUnknownError
+			// Errors which have not been classified exit with status 1, as they always have, so that scripts which check for it keep working.
+			errorCode = 1
 		}
 		os.Exit(errorCode)
 	}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_splitArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"--quiet", []string{"--quiet"}},
+		{"  --role   Admin ", []string{"--role", "Admin"}},
+		{`--role "Power User"`, []string{"--role", "Power User"}},
+		{`--role 'Power "User"'`, []string{"--role", `Power "User"`}},
+		{`--role Power\ User`, []string{"--role", "Power User"}},
+		{`--role ""`, []string{"--role", ""}},
+	}
+
+	for _, tt := range tests {
+		args, err := splitArgs(tt.input)
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, args, tt.input)
+	}
+
+	_, err := splitArgs(`--role "Power`)
+	assert.Error(t, err)
+	_, err = splitArgs(`--role \`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package oauth2cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/RobotsAndPencils/go-saml"
+	"github.com/riotgames/key-conjurer/internal/oktawebsso"
+	"golang.org/x/net/html"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoSAMLAssertion indicates that an AssertionProvider did not find a SAML assertion in the response from the identity provider.
+var ErrNoSAMLAssertion = oktawebsso.ErrNoSAMLAssertion
+
+// ErrAssertionResponseTooLarge indicates that the response from an assertion endpoint was larger than the provider will read.
+var ErrAssertionResponseTooLarge = oktawebsso.ErrAssertionResponseTooLarge
+
+// DefaultMaxAssertionResponseSize is the largest response body, in bytes, an HTTPAssertionProvider will read.
+const DefaultMaxAssertionResponseSize = oktawebsso.DefaultMaxAssertionResponseSize
+
+// AssertionProvider exchanges the tokens obtained when the user logged in for a SAML assertion which can be used to sign in to an application.
+type AssertionProvider interface {
+	// Assertion returns the base64 encoded SAMLResponse for the application with the given ID.
+	Assertion(ctx context.Context, ts oauth2.TokenSource, applicationID string) (string, error)
+}
+
+// OktaAssertionProvider retrieves assertions using Okta's web SSO flow, in which the user's tokens are exchanged for a web SSO token which is then presented to Okta's /login/token/sso endpoint.
+//
+// This flow is undocumented but is used by Okta in their own okta-aws-cli.
+type OktaAssertionProvider struct {
+	OIDCDomain string
+	ClientID   string
+}
+
+func (p OktaAssertionProvider) Assertion(ctx context.Context, ts oauth2.TokenSource, applicationID string) (string, error) {
+	oauthCfg, err := DiscoverConfig(ctx, p.OIDCDomain, p.ClientID)
+	if err != nil {
+		return "", fmt.Errorf("discover oauth2 config: %w", err)
+	}
+
+	tok, err := oktawebsso.ExchangeAccessToken(ctx, oauthCfg, ts, applicationID)
+	if err != nil {
+		return "", fmt.Errorf("get websso token: %w", err)
+	}
+
+	assertionBytes, err := oktawebsso.GetSAMLAssertion(ctx, p.OIDCDomain, tok)
+	if err != nil {
+		return "", fmt.Errorf("get saml assertion: %w", err)
+	}
+
+	return string(assertionBytes), nil
+}
+
+// ApplicationPlaceholder is replaced by the ID of the application in the URL of an HTTPAssertionProvider.
+const ApplicationPlaceholder = "{application}"
+
+// HTTPAssertionProvider retrieves assertions from an identity provider endpoint which accepts the user's access token as a bearer token.
+//
+// The endpoint may respond with either:
+//
+//   - An HTML page containing a form with a SAMLResponse input, as is served to browsers during IdP-initiated sign in.
+//   - A JSON object with a SAMLResponse or saml_response field.
+type HTTPAssertionProvider struct {
+	// URL is the address of the endpoint. Any occurrence of ApplicationPlaceholder is replaced with the ID of the application.
+	URL string
+	// MaxResponseSize is the largest response body, in bytes, that will be read. If zero, DefaultMaxAssertionResponseSize is used.
+	MaxResponseSize int64
+}
+
+func (p HTTPAssertionProvider) Assertion(ctx context.Context, ts oauth2.TokenSource, applicationID string) (string, error) {
+	tok, err := ts.Token()
+	if err != nil {
+		return "", err
+	}
+
+	uri := strings.ReplaceAll(p.URL, ApplicationPlaceholder, url.PathEscape(applicationID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid assertion url: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/html, application/json")
+	tok.SetAuthHeader(req)
+
+	client := http.DefaultClient
+	if val, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		client = val
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get saml assertion: %s returned %s", req.URL.Redacted(), resp.Status)
+	}
+
+	limit := p.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultMaxAssertionResponseSize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return "", fmt.Errorf("read saml response: %w", err)
+	}
+
+	if int64(len(body)) > limit {
+		return "", ErrAssertionResponseTooLarge
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		return assertionFromJSON(bytes.NewReader(body))
+	}
+
+	return assertionFromHTML(bytes.NewReader(body))
+}
+
+func assertionFromJSON(r io.Reader) (string, error) {
+	var body struct {
+		SAMLResponse      string `json:"SAMLResponse"`
+		SAMLResponseSnake string `json:"saml_response"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode saml response: %w", err)
+	}
+
+	if body.SAMLResponse != "" {
+		return body.SAMLResponse, nil
+	}
+
+	if body.SAMLResponseSnake != "" {
+		return body.SAMLResponseSnake, nil
+	}
+
+	return "", ErrNoSAMLAssertion
+}
+
+func assertionFromHTML(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", fmt.Errorf("parse html: %w", err)
+	}
+
+	form, ok := oktawebsso.FindFirstForm(doc)
+	if !ok {
+		return "", ErrNoSAMLAssertion
+	}
+
+	assertion, ok := form.Inputs["SAMLResponse"]
+	if !ok {
+		return "", ErrNoSAMLAssertion
+	}
+
+	return assertion, nil
+}
+
+// ExchangeTokenForAssertion uses provider to retrieve a SAML assertion for the application with the given ID.
+//
+// Both the parsed assertion and its base64 encoded form are returned, since the latter is what must be given to AWS.
+func ExchangeTokenForAssertion(ctx context.Context, provider AssertionProvider, ts oauth2.TokenSource, applicationID string) (*saml.Response, string, error) {
+	assertion, err := provider.Assertion(ctx, ts, applicationID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	response, err := saml.ParseEncodedResponse(assertion)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse saml response: %w", err)
+	}
+
+	return response, assertion, nil
+}
@@ -0,0 +1,73 @@
+package oauth2cli
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestHTTPAssertionProvider(t *testing.T) {
+	var requested string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/saml/html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><form method="POST" action="https://signin.aws.amazon.com/saml"><input type="hidden" name="SAMLResponse" value="PHNhbWw+"></form></body></html>`))
+		case "/saml/json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"saml_response":"PHNhbWw+"}`))
+		case "/saml/empty":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body>Nothing to see here</body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access-token", TokenType: "Bearer"})
+	p := HTTPAssertionProvider{URL: srv.URL + "/saml/" + ApplicationPlaceholder}
+
+	for _, app := range []string{"html", "json"} {
+		assertion, err := p.Assertion(context.Background(), ts, app)
+		require.NoError(t, err, app)
+		assert.Equal(t, "PHNhbWw+", assertion, app)
+		assert.Equal(t, "/saml/"+app, requested)
+	}
+
+	_, err := p.Assertion(context.Background(), ts, "empty")
+	assert.True(t, errors.Is(err, ErrNoSAMLAssertion))
+
+	_, err = p.Assertion(context.Background(), ts, "missing")
+	assert.ErrorContains(t, err, "404 Not Found")
+
+	_, err = p.Assertion(context.Background(), oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "wrong"}), "html")
+	assert.ErrorContains(t, err, "401 Unauthorized")
+
+	p.MaxResponseSize = 32
+	_, err = p.Assertion(context.Background(), ts, "html")
+	assert.ErrorIs(t, err, ErrAssertionResponseTooLarge)
+}
+
+type fakeAssertionProvider string
+
+func (p fakeAssertionProvider) Assertion(context.Context, oauth2.TokenSource, string) (string, error) {
+	return string(p), nil
+}
+
+func TestExchangeTokenForAssertion(t *testing.T) {
+	_, _, err := ExchangeTokenForAssertion(context.Background(), fakeAssertionProvider("not base64!"), nil, "app")
+	assert.ErrorContains(t, err, "parse saml response")
+}
@@ -11,7 +11,6 @@ import (
 
 	"github.com/RobotsAndPencils/go-saml"
 	"github.com/coreos/go-oidc"
-	"github.com/riotgames/key-conjurer/internal/oktawebsso"
 	"golang.org/x/oauth2"
 )
 
@@ -69,26 +68,9 @@ func (r AuthorizationCodeHandler) HandlePendingSession(ctx context.Context, list
 	return handler.Wait(ctx, state, verifier)
 }
 
+// DiscoverConfigAndExchangeTokenForAssertion retrieves a SAML assertion for the application with the given ID using Okta's web SSO flow.
+//
+// It is equivalent to calling ExchangeTokenForAssertion with an OktaAssertionProvider.
 func DiscoverConfigAndExchangeTokenForAssertion(ctx context.Context, ts oauth2.TokenSource, oidcDomain, clientID, applicationID string) (*saml.Response, string, error) {
-	oauthCfg, err := DiscoverConfig(ctx, oidcDomain, clientID)
-	if err != nil {
-		return nil, "", fmt.Errorf("discover oauth2 config: %w", err)
-	}
-
-	tok, err := oktawebsso.ExchangeAccessToken(ctx, oauthCfg, ts, applicationID)
-	if err != nil {
-		return nil, "", fmt.Errorf("get websso token: %w", err)
-	}
-
-	assertionBytes, err := oktawebsso.GetSAMLAssertion(ctx, oidcDomain, tok)
-	if err != nil {
-		return nil, "", fmt.Errorf("get saml assertion: %w", err)
-	}
-
-	response, err := saml.ParseEncodedResponse(string(assertionBytes))
-	if err != nil {
-		return nil, "", fmt.Errorf("parse saml response: %w", err)
-	}
-
-	return response, string(assertionBytes), nil
+	return ExchangeTokenForAssertion(ctx, OktaAssertionProvider{OIDCDomain: oidcDomain, ClientID: clientID}, ts, applicationID)
 }
@@ -46,12 +46,12 @@ func Test_handler_YieldsCorrectlyFormattedState(t *testing.T) {
 		expectedToken = &oauth2.Token{
 			AccessToken: "1234",
 		}
-		state    = "state goes here"
-		code     = "code goes here"
-		verifier = oauth2.GenerateVerifier()
-		dl, _    = t.Deadline()
-		ctx, _   = context.WithDeadline(context.Background(), dl)
-		values   = url.Values{
+		state       = "state goes here"
+		code        = "code goes here"
+		verifier    = oauth2.GenerateVerifier()
+		dl, _       = t.Deadline()
+		ctx, cancel = context.WithDeadline(context.Background(), dl)
+		values      = url.Values{
 			"state": []string{state},
 			"code":  []string{code},
 		}
@@ -65,6 +65,7 @@ func Test_handler_YieldsCorrectlyFormattedState(t *testing.T) {
 		w = httptest.NewRecorder()
 	)
 
+	t.Cleanup(cancel)
 	ex.AddToken(code, expectedToken)
 
 	go handle.ServeHTTP(w, r)
@@ -2,10 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/coreos/go-oidc"
@@ -13,15 +21,44 @@ import (
 	"github.com/urfave/cli/v3"
 )
 
+const (
+	lambdaEventALB          = "alb"
+	lambdaEventAPIGateway   = "apigateway"
+	lambdaEventAPIGatewayV2 = "apigatewayv2"
+)
+
+// oktaSelfTestTimeout is how long the startup check of the Okta credentials may take.
+const oktaSelfTestTimeout = 10 * time.Second
+
+// Vars for build time
+var (
+	Version        = "TBD"
+	BuildTimestamp = "BuildTimestamp is not set"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
 func main() {
 	cmd := cli.Command{
 		Action: runServer,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "okta-host",
-				Usage:    "Okta host (e.g., 'example.okta.com')",
-				Sources:  cli.EnvVars("KEYCONJURER_OKTA_HOST"),
-				Required: true,
+				Name:    "okta-host",
+				Usage:   "Okta host (e.g., 'example.okta.com'). Required unless both --directory-file and --oidc-issuer are set",
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_HOST"),
+			},
+			&cli.StringFlag{
+				Name:    "directory-file",
+				Usage:   "Read the applications each user may access from this YAML file instead of Okta",
+				Sources: cli.EnvVars("KEYCONJURER_DIRECTORY_FILE"),
+			},
+			&cli.StringFlag{
+				Name:    "oidc-issuer",
+				Usage:   "The OpenID Connect issuer which authenticates users. Defaults to the Okta org authorization server of --okta-host",
+				Sources: cli.EnvVars("KEYCONJURER_OIDC_ISSUER"),
 			},
 			&cli.StringFlag{
 				Name:    "okta-token",
@@ -31,10 +68,169 @@ func main() {
 				Name:    "okta-token-file",
 				Sources: cli.EnvVars("KEYCONJURER_OKTA_TOKEN_FILE"),
 			},
+			&cli.BoolFlag{
+				Name:    "okta-self-test",
+				Usage:   "Check that Okta accepts the configured credentials before serving requests. This makes an Okta API call each time the server starts, including on every Lambda cold start",
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_SELF_TEST"),
+			},
+			&cli.StringFlag{
+				Name:    "okta-client-id",
+				Usage:   "Authenticate to Okta as this OAuth 2.0 service app using a private key JWT instead of an API token",
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_CLIENT_ID"),
+			},
+			&cli.StringFlag{
+				Name:    "okta-private-key",
+				Usage:   "The PEM encoded RSA private key of the service app given by --okta-client-id",
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_PRIVATE_KEY"),
+			},
+			&cli.StringFlag{
+				Name:    "okta-private-key-file",
+				Usage:   "A file containing the private key of the service app given by --okta-client-id",
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_PRIVATE_KEY_FILE"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "okta-scope",
+				Usage:   "A scope to request when authenticating as the service app given by --okta-client-id. May be given more than once",
+				Value:   api.DefaultOktaScopes,
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_SCOPES"),
+			},
+			&cli.StringFlag{
+				Name:    "user-claim",
+				Usage:   "The claim which identifies the user: preferred_username, sub, email, or any other claim whose value is an Okta user ID or login",
+				Value:   api.UserClaimPreferredUsername,
+				Sources: cli.EnvVars("KEYCONJURER_USER_CLAIM"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "token-audience",
+				Usage:   "Verify bearer tokens which are JWTs locally, accepting tokens issued for this audience, such as the client ID of the CLI. May be given more than once. Opaque tokens are still checked with the userinfo endpoint",
+				Sources: cli.EnvVars("KEYCONJURER_TOKEN_AUDIENCES"),
+			},
+			&cli.StringFlag{
+				Name:    "token-issuer",
+				Usage:   "The issuer of tokens verified locally, such as an Okta custom authorization server. Defaults to the Okta org authorization server",
+				Sources: cli.EnvVars("KEYCONJURER_TOKEN_ISSUER"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "token-required-scope",
+				Usage:   "Require tokens verified locally to carry this scope. May be given more than once",
+				Sources: cli.EnvVars("KEYCONJURER_TOKEN_REQUIRED_SCOPES"),
+			},
+			&cli.StringFlag{
+				Name:    "listen",
+				Usage:   "Serve HTTP on this address (e.g., ':8080') instead of running as a Lambda function",
+				Sources: cli.EnvVars("KEYCONJURER_LISTEN"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-cert-file",
+				Usage:   "Serve HTTPS using the certificate in this file. Requires --listen and --tls-key-file",
+				Sources: cli.EnvVars("KEYCONJURER_TLS_CERT_FILE"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-key-file",
+				Usage:   "The private key for --tls-cert-file",
+				Sources: cli.EnvVars("KEYCONJURER_TLS_KEY_FILE"),
+			},
+			&cli.StringFlag{
+				Name:    "tls-min-version",
+				Usage:   "The minimum TLS version to accept, either 1.2 or 1.3",
+				Value:   "1.2",
+				Sources: cli.EnvVars("KEYCONJURER_TLS_MIN_VERSION"),
+			},
+			&cli.StringFlag{
+				Name:    "metrics-listen",
+				Usage:   "Serve Prometheus metrics at /metrics over HTTP on this address (e.g., '127.0.0.1:9090'). Requires --listen. Metrics are not served if empty",
+				Sources: cli.EnvVars("KEYCONJURER_METRICS_LISTEN"),
+			},
+			&cli.DurationFlag{
+				Name:    "shutdown-timeout",
+				Usage:   "How long to wait for in-flight requests to complete when shutting down",
+				Value:   10 * time.Second,
+				Sources: cli.EnvVars("KEYCONJURER_SHUTDOWN_TIMEOUT"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "app-name",
+				Usage:   "Serve only Okta applications with this name, such as amazon_aws. May be given more than once. Set to an empty string to serve applications of any kind",
+				Value:   []string{api.AppNameAWS},
+				Sources: cli.EnvVars("KEYCONJURER_APP_NAMES"),
+			},
+			&cli.StringFlag{
+				Name:    "app-label-pattern",
+				Usage:   "Serve only applications whose label matches this regular expression",
+				Sources: cli.EnvVars("KEYCONJURER_APP_LABEL_PATTERN"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "allow-app-id",
+				Usage:   "Serve only applications with this instance ID. May be given more than once",
+				Sources: cli.EnvVars("KEYCONJURER_ALLOW_APP_IDS"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "deny-app-id",
+				Usage:   "Never serve the application with this instance ID. May be given more than once",
+				Sources: cli.EnvVars("KEYCONJURER_DENY_APP_IDS"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "require-group",
+				Usage:   "Serve applications only to members of this Okta group, given by ID or name. May be given more than once, in which case membership of any one group is enough",
+				Sources: cli.EnvVars("KEYCONJURER_REQUIRE_GROUPS"),
+			},
+			&cli.DurationFlag{
+				Name:    "cache-ttl",
+				Usage:   "How long to cache the Okta app links of each user for. Set to 0 to disable caching",
+				Value:   5 * time.Minute,
+				Sources: cli.EnvVars("KEYCONJURER_CACHE_TTL"),
+			},
+			&cli.IntFlag{
+				Name:    "cache-size",
+				Usage:   "The maximum number of users whose app links are cached",
+				Value:   10000,
+				Sources: cli.EnvVars("KEYCONJURER_CACHE_SIZE"),
+			},
+			&cli.FloatFlag{
+				Name:    "rate-limit",
+				Usage:   "The number of requests per second served across all users. Set to 0 to disable",
+				Value:   20,
+				Sources: cli.EnvVars("KEYCONJURER_RATE_LIMIT"),
+			},
+			&cli.IntFlag{
+				Name:    "rate-limit-burst",
+				Usage:   "The number of requests that may be served at once across all users",
+				Value:   40,
+				Sources: cli.EnvVars("KEYCONJURER_RATE_LIMIT_BURST"),
+			},
+			&cli.FloatFlag{
+				Name:    "user-rate-limit",
+				Usage:   "The number of requests per second served to each user. Set to 0 to disable",
+				Value:   0.5,
+				Sources: cli.EnvVars("KEYCONJURER_USER_RATE_LIMIT"),
+			},
+			&cli.IntFlag{
+				Name:    "user-rate-limit-burst",
+				Usage:   "The number of requests that may be served at once to each user",
+				Value:   10,
+				Sources: cli.EnvVars("KEYCONJURER_USER_RATE_LIMIT_BURST"),
+			},
+			&cli.FloatFlag{
+				Name:    "okta-rate-limit-reserve",
+				Usage:   "The fraction of the Okta rate limit to leave unused. Requests that would need Okta are rejected, or served from the cache, until the limit resets",
+				Value:   0.1,
+				Sources: cli.EnvVars("KEYCONJURER_OKTA_RATE_LIMIT_RESERVE"),
+			},
+			&cli.StringFlag{
+				Name:    "audit-log",
+				Usage:   "Where to write audit events, one JSON object per line: stdout, stderr, none or the path of a file to append to",
+				Value:   "stdout",
+				Sources: cli.EnvVars("KEYCONJURER_AUDIT_LOG"),
+			},
+			&cli.StringFlag{
+				Name:    "lambda-event",
+				Usage:   "The type of event the Lambda function receives when not using --listen: alb, apigateway or apigatewayv2",
+				Value:   lambdaEventALB,
+				Sources: cli.EnvVars("KEYCONJURER_LAMBDA_EVENT"),
+			},
 		},
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	err := cmd.Run(ctx, os.Args)
@@ -44,33 +240,326 @@ func main() {
 	}
 }
 
-func runServer(ctx context.Context, cmd *cli.Command) error {
-	token := cmd.String("okta-token")
-	if token == "" {
-		tokenFile := cmd.String("okta-token-file")
-		if tokenFile == "" {
-			return cli.Exit("one of --okta-token or --okta-token-file must be specified", 1)
+// readSecret returns the value of the flag name, or the contents of the file given by the flag fileName if name is not set.
+func readSecret(cmd *cli.Command, name, fileName string) (string, error) {
+	if v := cmd.String(name); v != "" {
+		return v, nil
+	}
+
+	path := cmd.String(fileName)
+	if path == "" {
+		return "", nil
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %w", path, err)
+	}
+	// Secrets are often written to files with a trailing newline, which Okta would reject as part of the secret.
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// oktaDirectory returns the Okta service used as the application directory, checking the credentials first if --okta-self-test is set.
+func oktaDirectory(ctx context.Context, cmd *cli.Command, metrics *api.Metrics) (api.Okta, error) {
+	host := cmd.String("okta-host")
+	if host == "" {
+		return api.Okta{}, cli.Exit("--okta-host must be specified unless --directory-file is", 1)
+	}
+
+	service, err := oktaService(cmd, &url.URL{Scheme: "https", Host: host})
+	if err != nil {
+		return api.Okta{}, err
+	}
+
+	if cmd.Bool("okta-self-test") {
+		if err := checkOkta(ctx, service); err != nil {
+			return api.Okta{}, err
 		}
+	}
+
+	reserve := cmd.Float("okta-rate-limit-reserve")
+	if reserve < 0 || reserve >= 1 {
+		return api.Okta{}, cli.Exit("--okta-rate-limit-reserve must be at least 0 and less than 1", 1)
+	}
 
-		buf, err := os.ReadFile(tokenFile)
+	service.Metrics = metrics
+	service.RateLimits = api.NewOktaRateLimits(reserve)
+	return service, nil
+}
+
+// oktaService returns the Okta service, authenticating either as an OAuth 2.0 service app if --okta-client-id is set, or with an API token.
+func oktaService(cmd *cli.Command, domain *url.URL) (api.Okta, error) {
+	token, err := readSecret(cmd, "okta-token", "okta-token-file")
+	if err != nil {
+		return api.Okta{}, err
+	}
+
+	clientID := cmd.String("okta-client-id")
+	if clientID == "" {
+		if token == "" {
+			return api.Okta{}, cli.Exit("one of --okta-token, --okta-token-file or --okta-client-id must be specified", 1)
+		}
+		return api.NewOktaService(domain, token)
+	}
+
+	if token != "" {
+		return api.Okta{}, cli.Exit("--okta-client-id cannot be used with --okta-token or --okta-token-file", 1)
+	}
+
+	key, err := readSecret(cmd, "okta-private-key", "okta-private-key-file")
+	if err != nil {
+		return api.Okta{}, err
+	}
+
+	if key == "" {
+		return api.Okta{}, cli.Exit("one of --okta-private-key or --okta-private-key-file must be specified with --okta-client-id", 1)
+	}
+
+	return api.NewOktaServiceWithPrivateKey(domain, clientID, []byte(key), cmd.StringSlice("okta-scope"))
+}
+
+// checkOkta checks that Okta can be reached and accepts the configured credentials, so that a misconfigured server fails at startup rather than on the first request.
+func checkOkta(ctx context.Context, service api.Okta) error {
+	ctx, cancel := context.WithTimeout(ctx, oktaSelfTestTimeout)
+	defer cancel()
+
+	err := service.CheckCredentials(ctx)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, api.ErrUnauthorized):
+		return cli.Exit(fmt.Sprintf("Okta at %s rejected the configured credentials; check --okta-token, or --okta-client-id and --okta-private-key: %s", service.Domain.Host, err), 1)
+	default:
+		return cli.Exit(fmt.Sprintf("could not check the Okta credentials with %s: %s", service.Domain.Host, err), 1)
+	}
+}
+
+// tokenVerifier returns the verifier for bearer tokens which are JWTs, or nil if tokens should always be checked with the userinfo endpoint of idp.
+func tokenVerifier(ctx context.Context, cmd *cli.Command, idp *oidc.Provider) (*api.TokenVerifier, error) {
+	audiences := cmd.StringSlice("token-audience")
+	if len(audiences) == 0 {
+		if cmd.IsSet("token-issuer") || cmd.IsSet("token-required-scope") {
+			return nil, cli.Exit("--token-issuer and --token-required-scope require --token-audience", 1)
+		}
+		return nil, nil
+	}
+
+	provider := idp
+	if issuer := cmd.String("token-issuer"); issuer != "" {
+		var err error
+		if provider, err = oidc.NewProvider(ctx, issuer); err != nil {
+			return nil, fmt.Errorf("could not create OIDC provider for %s: %w", issuer, err)
+		}
+	}
+
+	return api.NewTokenVerifier(provider, audiences, cmd.StringSlice("token-required-scope")), nil
+}
+
+func runServer(ctx context.Context, cmd *cli.Command) error {
+	metrics := api.NewMetrics()
+	var directory api.ApplicationDirectory
+	var oktaRateLimits *api.OktaRateLimits
+	var checks []api.ReadinessCheck
+	if path := cmd.String("directory-file"); path != "" {
+		static, err := api.LoadStaticDirectory(path)
+		if err != nil {
+			return fmt.Errorf("could not load directory: %w", err)
+		}
+		directory = static
+	} else {
+		service, err := oktaDirectory(ctx, cmd, metrics)
 		if err != nil {
-			return fmt.Errorf("could not read %s", tokenFile)
+			return err
 		}
-		token = string(buf)
+		directory = service
+		oktaRateLimits = service.RateLimits
+		checks = append(checks, api.ReadinessCheck{Name: "okta", Check: service.Ping})
 	}
 
-	oktaDomain := url.URL{
-		Scheme: "https",
-		Host:   cmd.String("okta-host"),
+	issuer := cmd.String("oidc-issuer")
+	if issuer == "" {
+		host := cmd.String("okta-host")
+		if host == "" {
+			return cli.Exit("one of --okta-host or --oidc-issuer must be specified", 1)
+		}
+		issuer = "https://" + host
 	}
 
-	service := api.NewOktaService(&oktaDomain, token)
-	idp, err := oidc.NewProvider(ctx, oktaDomain.String())
+	idp, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
 		return fmt.Errorf("could not create OIDC provider: %w", err)
 	}
 
-	handler := api.ServeUserApplications(service, idp)
-	lambda.StartWithOptions(handler, lambda.WithContext(ctx))
+	filter, err := applicationFilter(cmd)
+	if err != nil {
+		return err
+	}
+
+	verifier, err := tokenVerifier(ctx, cmd, idp)
+	if err != nil {
+		return err
+	}
+
+	handler := api.ServeUserApplicationsHandler{
+		Directory:      directory,
+		Idp:            idp,
+		Filter:         filter,
+		UserClaim:      cmd.String("user-claim"),
+		TokenVerifier:  verifier,
+		OktaRateLimits: oktaRateLimits,
+		RateLimiter: api.NewRateLimiter(
+			api.Limit{Rate: cmd.Float("rate-limit"), Burst: int(cmd.Int("rate-limit-burst"))},
+			api.Limit{Rate: cmd.Float("user-rate-limit"), Burst: int(cmd.Int("user-rate-limit-burst"))},
+		),
+	}
+	if ttl := cmd.Duration("cache-ttl"); ttl > 0 {
+		handler.Cache = api.NewLRUCache(int(cmd.Int("cache-size")))
+		handler.CacheTTL = ttl
+		handler.CacheStats = &api.CacheStats{}
+		metrics.CacheStats = handler.CacheStats
+	}
+
+	audit, closeAudit, err := auditSink(cmd.String("audit-log"))
+	if err != nil {
+		return err
+	}
+	defer closeAudit()
+
+	router := api.NewRouter(handler)
+	health := api.HealthHandler{
+		Version:        Version,
+		BuildTimestamp: BuildTimestamp,
+		Checks:         append(checks, api.OIDCReadinessCheck(idp, http.DefaultClient)),
+	}
+	health.Register(router)
+	instrumented := api.Instrument(router, audit, metrics)
+	if addr := cmd.String("listen"); addr != "" {
+		return listenAndServe(ctx, cmd, addr, instrumented, metrics)
+	}
+
+	switch event := cmd.String("lambda-event"); event {
+	case lambdaEventALB:
+		lambda.StartWithOptions(api.ALBHandler(instrumented), lambda.WithContext(ctx))
+	case lambdaEventAPIGateway:
+		lambda.StartWithOptions(api.APIGatewayHandler(instrumented), lambda.WithContext(ctx))
+	case lambdaEventAPIGatewayV2:
+		lambda.StartWithOptions(api.APIGatewayV2Handler(instrumented), lambda.WithContext(ctx))
+	default:
+		return cli.Exit(fmt.Sprintf("--lambda-event must be one of %s, %s or %s, got %q", lambdaEventALB, lambdaEventAPIGateway, lambdaEventAPIGatewayV2, event), 1)
+	}
+	return nil
+}
+
+func applicationFilter(cmd *cli.Command) (*api.ApplicationFilter, error) {
+	filter := api.ApplicationFilter{
+		AllowIDs:       cmd.StringSlice("allow-app-id"),
+		DenyIDs:        cmd.StringSlice("deny-app-id"),
+		RequiredGroups: cmd.StringSlice("require-group"),
+	}
+
+	for _, name := range cmd.StringSlice("app-name") {
+		if name != "" {
+			filter.AppNames = append(filter.AppNames, name)
+		}
+	}
+
+	if pattern := cmd.String("app-label-pattern"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, cli.Exit(fmt.Sprintf("--app-label-pattern is not a valid regular expression: %s", err), 1)
+		}
+		filter.LabelPattern = re
+	}
+
+	return &filter, nil
+}
+
+// auditSink returns the sink that audit events are written to according to the value of --audit-log, and a function which closes it.
+func auditSink(dest string) (api.AuditSink, func() error, error) {
+	noop := func() error { return nil }
+	switch dest {
+	case "none":
+		return nil, noop, nil
+	case "", "stdout":
+		return &api.JSONAuditSink{W: os.Stdout}, noop, nil
+	case "stderr":
+		return &api.JSONAuditSink{W: os.Stderr}, noop, nil
+	}
+
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+	return &api.JSONAuditSink{W: f}, f.Close, nil
+}
+
+// listenAndServe serves handler over HTTP on addr until ctx is cancelled, then waits for in-flight requests to complete.
+//
+// Metrics are served at /metrics on the address given by --metrics-listen, if any.
+func listenAndServe(ctx context.Context, cmd *cli.Command, addr string, handler api.Handler, metrics *api.Metrics) error {
+	certFile, keyFile := cmd.String("tls-cert-file"), cmd.String("tls-key-file")
+	if (certFile == "") != (keyFile == "") {
+		return cli.Exit("--tls-cert-file and --tls-key-file must be specified together", 1)
+	}
+
+	minVersion, ok := tlsVersions[cmd.String("tls-min-version")]
+	if !ok {
+		return cli.Exit(fmt.Sprintf("--tls-min-version must be 1.2 or 1.3, got %q", cmd.String("tls-min-version")), 1)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           api.HTTPHandler(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: minVersion},
+	}
+
+	servers := []*http.Server{srv}
+	errs := make(chan error, 2)
+	go func() {
+		slog.Info("listening", slog.String("addr", addr), slog.Bool("tls", certFile != ""))
+		if certFile != "" {
+			errs <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+
+	// Metrics are served on their own address so that they are not exposed to the clients of the API.
+	if metricsAddr := cmd.String("metrics-listen"); metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		metricsSrv := &http.Server{Addr: metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		servers = append(servers, metricsSrv)
+		go func() {
+			slog.Info("serving metrics", slog.String("addr", metricsAddr))
+			errs <- metricsSrv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", slog.Duration("timeout", cmd.Duration("shutdown-timeout")))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cmd.Duration("shutdown-timeout"))
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("could not shut down cleanly: %w", err)
+		}
+	}
+
+	for range servers {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
 	return nil
 }